@@ -0,0 +1,262 @@
+package dnsmasq
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Finding kinds reported by Lint
+const (
+	Conflict  = "conflict"  // the same domain has rules with different effects; Rule wins if either does
+	Duplicate = "duplicate" // the same rule is set in more than one file
+	Shadowed  = "shadowed"  // Rule, for a subdomain, overrides Other for part of its domain
+)
+
+const (
+	local    = "local="
+	wildcard = "#"
+)
+
+// Rule is a domain specific address=, server= or local= line from a dnsmasq configuration file
+type Rule struct {
+	File      string
+	Line      int
+	Kind      string // address=, server= or local=
+	Domain    string
+	Value     string
+	Blacklist bool // File was generated by the blacklist
+}
+
+// Finding is a pair of rules in different files that duplicate, conflict with or shadow each other
+type Finding struct {
+	Kind  string
+	Rule  Rule
+	Other Rule
+}
+
+// String returns the rule as dnsmasq configuration
+func (r Rule) String() string {
+	return fmt.Sprintf("%s/%s/%s", r.Kind, r.Domain, r.Value)
+}
+
+// where returns the rule's file and line, marking blacklist files
+func (r Rule) where() string {
+	s := fmt.Sprintf("%s:%d", r.File, r.Line)
+	if r.Blacklist {
+		s += " (blacklist)"
+	}
+	return s
+}
+
+// String returns a one line description of a finding
+func (f Finding) String() string {
+	var verb string
+	switch f.Kind {
+	case Conflict:
+		verb = "conflicts with"
+		if f.Rule.beats(f.Other) {
+			verb = "overrides"
+		}
+	case Duplicate:
+		verb = "duplicates"
+	case Shadowed:
+		verb = "shadows"
+	}
+	return fmt.Sprintf("%s: %s: %s %s %s: %s", f.Kind, f.Rule.where(), f.Rule, verb, f.Other.where(), f.Other)
+}
+
+// action returns what a rule does to a query, so rules with the same action are equivalent;
+// local=/d/ is the same as server=/d/
+func (r Rule) action() string {
+	if r.Kind == local {
+		return server
+	}
+	return r.Kind + r.Value
+}
+
+// family returns the address family an address= rule answers for, or "" if it answers for both
+func (r Rule) family() string {
+	ip := net.ParseIP(r.Value)
+	switch {
+	case r.Kind != address, ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return "4"
+	}
+	return "6"
+}
+
+// beats reports whether r takes precedence over other for the same domain; address= wins over server=
+func (r Rule) beats(other Rule) bool {
+	return r.Kind == address && other.Kind != address
+}
+
+// conflicts reports whether two rules for the same domain have effects that can't both apply
+func (r Rule) conflicts(other Rule) bool {
+	switch {
+	case r.action() == other.action():
+		return false
+	case r.Kind == address && other.Kind == address:
+		a, b := r.family(), other.family()
+		return a == "" || b == "" || a == b
+	case r.Kind != address && other.Kind != address:
+		return false // dnsmasq uses every server= for a domain
+	}
+	return true
+}
+
+// parseRules returns the domain specific rules in a dnsmasq configuration line
+func parseRules(line string) (kind string, domains []string, value string) {
+	for _, k := range []string{address, server, local} {
+		if strings.HasPrefix(line, k+"/") {
+			kind = k
+			break
+		}
+	}
+
+	d := strings.Split(strings.TrimPrefix(line, kind), "/")
+	if kind == "" || len(d) < 3 {
+		return "", nil, ""
+	}
+	return kind, d[1 : len(d)-1], d[len(d)-1]
+}
+
+// readRules returns the domain specific rules in a dnsmasq configuration file
+func readRules(file string, blacklist bool) ([]Rule, error) {
+	f, err := os.Open(file) // nolint
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		b     = bufio.NewScanner(f)
+		rules []Rule
+	)
+	b.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for n := 1; b.Scan(); n++ {
+		kind, domains, value := parseRules(strings.TrimSpace(b.Text()))
+		for _, d := range domains {
+			if d == "" {
+				continue
+			}
+			rules = append(rules, Rule{File: file, Line: n, Kind: kind, Domain: strings.ToLower(d), Value: value, Blacklist: blacklist})
+		}
+	}
+	return rules, b.Err()
+}
+
+// confFiles returns the files dnsmasq reads from a conf-dir, skipping dot, backup and #temporary# files
+func confFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, e := range entries {
+		n := e.Name()
+		switch {
+		case e.IsDir(), strings.HasPrefix(n, "."), strings.HasSuffix(n, "~"),
+			strings.HasPrefix(n, "#") && strings.HasSuffix(n, "#"):
+			continue
+		}
+		files = append(files, filepath.Join(dir, n))
+	}
+	return files, nil
+}
+
+// parents returns the domains that match a domain for dnsmasq, nearest first, ending with the # wildcard
+func parents(domain string) []string {
+	var p []string
+	for i := strings.Index(domain, "."); i >= 0; i = strings.Index(domain, ".") {
+		domain = domain[i+1:]
+		p = append(p, domain)
+	}
+	return append(p, wildcard)
+}
+
+// Lint loads every file in a dnsmasq conf-dir, applies dnsmasq's longest match precedence and reports rules
+// in different files that duplicate, conflict with or shadow each other; files ending in ext were generated
+// by the blacklist, and findings between two blacklist files are left out
+func Lint(dir, ext string) ([]Finding, error) {
+	files, err := confFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byDomain := make(map[string][]Rule)
+	for _, f := range files {
+		rules, err := readRules(f, ext != "" && strings.HasSuffix(f, ext))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rules {
+			byDomain[r.Domain] = append(byDomain[r.Domain], r)
+		}
+	}
+
+	var (
+		findings []Finding
+		report   = func(kind string, r, other Rule) {
+			if r.File != other.File && !(r.Blacklist && other.Blacklist) {
+				findings = append(findings, Finding{Kind: kind, Rule: r, Other: other})
+			}
+		}
+	)
+
+	for domain, rules := range byDomain {
+		for i, r := range rules {
+			for _, other := range rules[i+1:] {
+				switch {
+				case r.Kind == other.Kind && r.Value == other.Value:
+					report(Duplicate, other, r)
+				case !r.conflicts(other):
+				case other.beats(r):
+					report(Conflict, other, r)
+				default:
+					report(Conflict, r, other)
+				}
+			}
+		}
+
+		if domain == wildcard {
+			continue
+		}
+
+		for _, p := range parents(domain) {
+			broader, ok := byDomain[p]
+			if !ok {
+				continue
+			}
+			for _, r := range rules {
+				for _, other := range broader {
+					if r.action() != other.action() {
+						report(Shadowed, r, other)
+					}
+				}
+			}
+			break // only the nearest parent applies, it shadows the rest
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		switch {
+		case a.Rule.File != b.Rule.File:
+			return a.Rule.File < b.Rule.File
+		case a.Rule.Line != b.Rule.Line:
+			return a.Rule.Line < b.Rule.Line
+		case a.Rule.Domain != b.Rule.Domain:
+			return a.Rule.Domain < b.Rule.Domain
+		}
+		return a.Other.String()+a.Other.where() < b.Other.String()+b.Other.where()
+	})
+	return findings, nil
+}
@@ -0,0 +1,106 @@
+package dnsmasq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLint(t *testing.T) {
+	Convey("Testing Lint()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testLint")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		for f, data := range map[string]string{
+			"corp.conf": strings.Join([]string{
+				"# corporate resolvers",
+				"server=/corp.example/10.0.0.1",
+				"server=/partner.example/10.0.0.2",
+				"address=/printer.lan/192.168.1.5",
+				"server=8.8.8.8",
+				"",
+			}, "\n"),
+			"local.conf": "local=/lan/\naddress=/printer.lan/192.168.1.5\n",
+			"domains.ads.blacklist.conf": strings.Join([]string{
+				"address=/corp.example/0.0.0.0",
+				"address=/tracker.partner.example/0.0.0.0",
+				"address=/ads.example.com/0.0.0.0",
+				"",
+			}, "\n"),
+			"domains.malware.blacklist.conf": "address=/ads.example.com/0.0.0.0\naddress=/ads.example.com/::\n",
+			".blacklist.staging-1":           "address=/corp.example/10.0.0.9\n",
+			"corp.conf~":                     "address=/corp.example/10.0.0.9\n",
+		} {
+			So(ioutil.WriteFile(filepath.Join(dir, f), []byte(data), 0o644), ShouldBeNil)
+		}
+
+		findings, err := Lint(dir, ".blacklist.conf")
+		So(err, ShouldBeNil)
+
+		var act []string
+		for _, f := range findings {
+			act = append(act, strings.ReplaceAll(f.String(), dir+"/", ""))
+		}
+
+		So(act, ShouldResemble, []string{
+			"shadowed: corp.conf:4: address=/printer.lan/192.168.1.5 shadows local.conf:1: local=/lan/",
+			"conflict: domains.ads.blacklist.conf:1 (blacklist): address=/corp.example/0.0.0.0 overrides corp.conf:2: server=/corp.example/10.0.0.1",
+			"shadowed: domains.ads.blacklist.conf:2 (blacklist): address=/tracker.partner.example/0.0.0.0 shadows corp.conf:3: server=/partner.example/10.0.0.2",
+			"duplicate: local.conf:2: address=/printer.lan/192.168.1.5 duplicates corp.conf:4: address=/printer.lan/192.168.1.5",
+		})
+		So(findings[1].Rule.Blacklist, ShouldBeTrue)
+		So(findings[1].Other.Blacklist, ShouldBeFalse)
+
+		Convey("with an address conflict in the same family", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "sinkhole.conf"), []byte("address=/ads.example.com/127.0.0.1\n"), 0o644), ShouldBeNil)
+
+			findings, err := Lint(dir, ".blacklist.conf")
+			So(err, ShouldBeNil)
+
+			var conflicts []string
+			for _, f := range findings {
+				if f.Kind == Conflict && f.Rule.Domain == "ads.example.com" {
+					conflicts = append(conflicts, strings.ReplaceAll(f.String(), dir+"/", ""))
+				}
+			}
+			So(conflicts, ShouldResemble, []string{
+				"conflict: domains.ads.blacklist.conf:3 (blacklist): address=/ads.example.com/0.0.0.0 conflicts with sinkhole.conf:1: address=/ads.example.com/127.0.0.1",
+				"conflict: domains.malware.blacklist.conf:1 (blacklist): address=/ads.example.com/0.0.0.0 conflicts with sinkhole.conf:1: address=/ads.example.com/127.0.0.1",
+			})
+		})
+
+		Convey("with a missing directory", func() {
+			_, err := Lint(filepath.Join(dir, "missing"), ".blacklist.conf")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseRules(t *testing.T) {
+	Convey("Testing parseRules()", t, func() {
+		tests := []struct {
+			line    string
+			kind    string
+			domains []string
+			value   string
+		}{
+			{line: "address=/a.com/b.com/0.0.0.0", kind: address, domains: []string{"a.com", "b.com"}, value: "0.0.0.0"},
+			{line: "server=/corp.example/10.0.0.1#5353", kind: server, domains: []string{"corp.example"}, value: "10.0.0.1#5353"},
+			{line: "local=/lan/", kind: local, domains: []string{"lan"}},
+			{line: "server=8.8.8.8"},
+			{line: "conf-dir=/etc/dnsmasq.d"},
+		}
+
+		for _, tt := range tests {
+			kind, domains, value := parseRules(tt.line)
+			So(kind, ShouldEqual, tt.kind)
+			So(domains, ShouldResemble, tt.domains)
+			So(value, ShouldEqual, tt.value)
+		}
+	})
+}
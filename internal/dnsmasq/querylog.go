@@ -0,0 +1,303 @@
+package dnsmasq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	config  = "config"
+	unknown = "unknown"
+)
+
+// logLine matches a log-queries line, with or without the log-queries=extra serial number and client
+var logLine = regexp.MustCompile(`^(\w{3} +\d+ \d\d:\d\d:\d\d|\d{4}-\d\d-\d\dT\S+) .*?dnsmasq(?:\[\d+\])?: (?:(\d+) \S+ )?(\S+) (\S+) (is|from) (\S+)`)
+
+// Count is the number of blocked replies for a domain, client or source
+type Count struct {
+	Name   string `json:"name"`
+	Source string `json:"source,omitempty"`
+	Hits   int    `json:"hits"`
+}
+
+// Period is the number of queries and blocked replies in an hour
+type Period struct {
+	Start   time.Time `json:"start"`
+	Queries int       `json:"queries"`
+	Blocked int       `json:"blocked"`
+}
+
+// LogReport summarizes the blacklist's replies in a dnsmasq query log
+type LogReport struct {
+	Queries int      `json:"queries"`
+	Blocked int      `json:"blocked"`
+	Domains []Count  `json:"domains"`
+	Clients []Count  `json:"clients"`
+	Sources []Count  `json:"sources"`
+	Periods []Period `json:"periods"`
+	Note    string   `json:"note,omitempty"`
+}
+
+// blocklist maps the blacklist's answers to the sources that produced them
+type blocklist struct {
+	domains map[string]string // blocked domain to source
+	hosts   map[string]string // addn-hosts file to source
+	ips     map[string]bool   // redirect IPs
+}
+
+// load indexes the blocking rules in the blacklist's dnsmasq files, naming each source after its file less ext
+func (b *blocklist) load(files []string, ext string) error {
+	for _, file := range files {
+		f, err := os.Open(file) // nolint
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return err
+		}
+
+		label := strings.TrimSuffix(filepath.Base(file), ext)
+		s := bufio.NewScanner(f)
+		s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for s.Scan() {
+			line := strings.TrimSpace(s.Text())
+			if strings.HasPrefix(line, addnHosts) {
+				b.hosts[strings.TrimPrefix(line, addnHosts)] = label
+				continue
+			}
+
+			kind, domains, value := parseRules(line)
+			if kind != address && kind != local {
+				continue
+			}
+			for _, d := range domains {
+				if d != "" {
+					b.domains[strings.ToLower(d)] = label
+				}
+			}
+			if ip := net.ParseIP(value); ip != nil {
+				b.ips[ip.String()] = true
+			}
+		}
+
+		err = s.Err()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// source returns the source whose rule answered for domain, following dnsmasq's longest match
+func (b *blocklist) source(domain string) (string, bool) {
+	domain = strings.ToLower(domain)
+	for _, d := range append([]string{domain}, parents(domain)...) {
+		if s, ok := b.domains[d]; ok {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// blocked returns the source of a reply if the blacklist produced it
+func (b *blocklist) blocked(from, domain, answer string) (string, bool) {
+	if from != config {
+		s, ok := b.hosts[from]
+		return s, ok
+	}
+
+	s, ok := b.source(domain)
+	if !ok {
+		return "", false
+	}
+
+	if ip := net.ParseIP(answer); ip != nil {
+		return s, b.ips[ip.String()]
+	}
+	return s, strings.HasPrefix(answer, "NXDOMAIN") || strings.HasPrefix(answer, "NODATA")
+}
+
+// logTime parses a log timestamp; syslog leaves out the year, so it's taken as the latest year that isn't in the future
+func logTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("Jan _2 15:04:05", s, time.Local)
+	if err != nil {
+		return t, err
+	}
+
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, nil
+}
+
+// top returns the n counts with the most hits, ties in name order; n < 1 returns them all
+func top(hits map[string]int, sources map[string]string, n int) []Count {
+	counts := make([]Count, 0, len(hits))
+	for name, h := range hits {
+		counts = append(counts, Count{Name: name, Source: sources[name], Hits: h})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Hits != counts[j].Hits {
+			return counts[i].Hits > counts[j].Hits
+		}
+		return counts[i].Name < counts[j].Name
+	})
+
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// QueryLog reads a dnsmasq log-queries log and reports the top n domains and clients blocked by the blacklist,
+// the hits for each source and the hourly block rate; files are the blacklist's dnsmasq files, named
+// <source>ext
+func QueryLog(r io.Reader, files []string, ext string, n int) (*LogReport, error) {
+	b := &blocklist{
+		domains: make(map[string]string),
+		hosts:   make(map[string]string),
+		ips:     make(map[string]bool),
+	}
+	if err := b.load(files, ext); err != nil {
+		return nil, err
+	}
+
+	var (
+		rpt     = &LogReport{}
+		now     = time.Now()
+		clients = make(map[string]string) // pending query to client
+		domains = make(map[string]int)
+		sources = make(map[string]string)
+		byIP    = make(map[string]int)
+		bySrc   = make(map[string]int)
+		hours   = make(map[time.Time]*Period)
+		s       = bufio.NewScanner(r)
+	)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for s.Scan() {
+		m := logLine.FindStringSubmatch(s.Text())
+		if m == nil {
+			continue
+		}
+
+		t, err := logTime(m[1], now)
+		if err != nil {
+			continue
+		}
+
+		hour := t.Truncate(time.Hour)
+		p, ok := hours[hour]
+		if !ok {
+			p = &Period{Start: hour}
+			hours[hour] = p
+		}
+
+		serial, from, domain, verb, value := m[2], m[3], strings.ToLower(m[4]), m[5], m[6]
+		key := serial
+		if key == "" {
+			key = domain
+		}
+
+		if verb == "from" {
+			if strings.HasPrefix(from, "query[") {
+				clients[key] = value
+				rpt.Queries++
+				p.Queries++
+			}
+			continue
+		}
+
+		client, ok := clients[key]
+		if !ok {
+			client = unknown
+		}
+		delete(clients, key)
+
+		src, ok := b.blocked(from, domain, value)
+		if !ok {
+			continue
+		}
+
+		rpt.Blocked++
+		p.Blocked++
+		domains[domain]++
+		sources[domain] = src
+		byIP[client]++
+		bySrc[src]++
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	rpt.Domains = top(domains, sources, n)
+	rpt.Clients = top(byIP, nil, n)
+	rpt.Sources = top(bySrc, nil, 0)
+	for _, p := range hours {
+		rpt.Periods = append(rpt.Periods, *p)
+	}
+	sort.Slice(rpt.Periods, func(i, j int) bool { return rpt.Periods[i].Start.Before(rpt.Periods[j].Start) })
+	return rpt, nil
+}
+
+// rate returns blocked as a percentage of queries
+func rate(blocked, queries int) string {
+	if queries < 1 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(blocked)*100/float64(queries))
+}
+
+// String returns the report as tables
+func (r *LogReport) String() string {
+	var (
+		s strings.Builder
+		w = tabwriter.NewWriter(&s, 0, 0, 2, ' ', 0)
+	)
+
+	fmt.Fprintf(w, "Queries %d, blocked %d (%s)\n", r.Queries, r.Blocked, rate(r.Blocked, r.Queries))
+
+	fmt.Fprintln(w, "\nBlocked domain\tSource\tHits")
+	for _, c := range r.Domains {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", c.Name, c.Source, c.Hits)
+	}
+
+	fmt.Fprintln(w, "\nClient\tHits")
+	for _, c := range r.Clients {
+		fmt.Fprintf(w, "%s\t%d\n", c.Name, c.Hits)
+	}
+
+	fmt.Fprintln(w, "\nSource\tHits")
+	for _, c := range r.Sources {
+		fmt.Fprintf(w, "%s\t%d\n", c.Name, c.Hits)
+	}
+
+	fmt.Fprintln(w, "\nHour\tQueries\tBlocked\tRate")
+	for _, p := range r.Periods {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", p.Start.Format("2006-01-02 15:04"), p.Queries, p.Blocked, rate(p.Blocked, p.Queries))
+	}
+
+	if r.Note != "" {
+		fmt.Fprintf(w, "\n%s\n", r.Note)
+	}
+
+	w.Flush()
+	return s.String()
+}
@@ -0,0 +1,112 @@
+package dnsmasq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueryLog(t *testing.T) {
+	Convey("Testing QueryLog()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testQueryLog")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		hostsFile := filepath.Join(dir, "hosts.tracking.hosts")
+		files := []string{
+			filepath.Join(dir, "domains.ads.blacklist.conf"),
+			filepath.Join(dir, "hosts.tracking.blacklist.conf"),
+			filepath.Join(dir, "domains.excluded.blacklist.conf"),
+			filepath.Join(dir, "domains.missing.blacklist.conf"),
+		}
+
+		for f, data := range map[string]string{
+			files[0]:  "address=/ads.example.com/0.0.0.0\naddress=/doubleclick.net/0.0.0.0\nlocal=/malware.example/\naddress=/www.example.net/0.0.0.0\n",
+			files[1]:  "addn-hosts=" + hostsFile + "\n",
+			files[2]:  "server=/cdn.doubleclick.net/#\n",
+			hostsFile: "0.0.0.0 pixel.tracker.example\n",
+		} {
+			So(ioutil.WriteFile(f, []byte(data), 0o644), ShouldBeNil)
+		}
+
+		log := strings.Join([]string{
+			"Oct 19 10:00:01 router dnsmasq[1234]: query[A] ads.example.com from 192.168.1.10",
+			"Oct 19 10:00:01 router dnsmasq[1234]: config ads.example.com is 0.0.0.0",
+			"Oct 19 10:00:02 router dnsmasq[1234]: query[AAAA] sub.doubleclick.net from 192.168.1.11",
+			"Oct 19 10:00:02 router dnsmasq[1234]: config sub.doubleclick.net is 0.0.0.0",
+			"Oct 19 10:00:03 router dnsmasq[1234]: query[A] example.org from 192.168.1.10",
+			"Oct 19 10:00:03 router dnsmasq[1234]: forwarded example.org to 1.1.1.1",
+			"Oct 19 10:00:03 router dnsmasq[1234]: reply example.org is 93.184.216.34",
+			"Oct 19 10:00:04 router dnsmasq[1234]: query[A] printer.lan from 192.168.1.10",
+			"Oct 19 10:00:04 router dnsmasq[1234]: config printer.lan is 192.168.1.5",
+			"Oct 19 11:15:00 router dnsmasq[1234]: 7 192.168.1.12/41234 query[A] pixel.tracker.example from 192.168.1.12",
+			"Oct 19 11:15:00 router dnsmasq[1234]: 7 192.168.1.12/41234 " + hostsFile + " pixel.tracker.example is 0.0.0.0",
+			"Oct 19 11:16:00 router dnsmasq[1234]: query[A] www.malware.example from 192.168.1.10",
+			"Oct 19 11:16:00 router dnsmasq[1234]: config www.malware.example is NXDOMAIN",
+			"Oct 19 11:17:00 router dnsmasq[1234]: query[A] ads.example.com from 192.168.1.10",
+			"Oct 19 11:17:00 router dnsmasq[1234]: config ads.example.com is 0.0.0.0",
+			"Oct 19 11:17:30 router dnsmasq[1234]: query[A] www.example.net from 192.168.1.13",
+			"Oct 19 11:17:30 router dnsmasq[1234]: cached www.example.net is 198.51.100.7",
+			"Oct 19 11:17:31 router dnsmasq[1234]: config www.example.net is 0.0.0.0",
+			"Oct 19 11:18:00 router dnsmasq[1234]: started, version 2.85 cachesize 150",
+			"",
+		}, "\n")
+
+		r, err := QueryLog(strings.NewReader(log), files, ".blacklist.conf", 2)
+		So(err, ShouldBeNil)
+
+		So(r.Queries, ShouldEqual, 8)
+		So(r.Blocked, ShouldEqual, 6)
+		So(r.Domains, ShouldResemble, []Count{
+			{Name: "ads.example.com", Source: "domains.ads", Hits: 2},
+			{Name: "pixel.tracker.example", Source: "hosts.tracking", Hits: 1},
+		})
+		So(r.Clients, ShouldResemble, []Count{
+			{Name: "192.168.1.10", Hits: 3},
+			{Name: "192.168.1.11", Hits: 1},
+		})
+		So(r.Sources, ShouldResemble, []Count{
+			{Name: "domains.ads", Hits: 5},
+			{Name: "hosts.tracking", Hits: 1},
+		})
+
+		So(len(r.Periods), ShouldEqual, 2)
+		So(r.Periods[0].Start.Format("Jan _2 15:04"), ShouldEqual, "Oct 19 10:00")
+		So(r.Periods[0].Queries, ShouldEqual, 4)
+		So(r.Periods[0].Blocked, ShouldEqual, 2)
+		So(r.Periods[1].Queries, ShouldEqual, 4)
+		So(r.Periods[1].Blocked, ShouldEqual, 4)
+
+		So(r.String(), ShouldContainSubstring, "Queries 8, blocked 6 (75.0%)")
+
+		r.Note = "merged"
+		So(r.String(), ShouldEndWith, "merged\n")
+		So(r.String(), ShouldContainSubstring, "ads.example.com        domains.ads     2")
+	})
+}
+
+func TestLogTime(t *testing.T) {
+	Convey("Testing logTime()", t, func() {
+		now := time.Date(2026, 1, 2, 0, 0, 0, 0, time.Local)
+
+		act, err := logTime("Dec 31 23:59:59", now)
+		So(err, ShouldBeNil)
+		So(act.Year(), ShouldEqual, 2025)
+
+		act, err = logTime("Jan  1 00:00:01", now)
+		So(err, ShouldBeNil)
+		So(act.Year(), ShouldEqual, 2026)
+
+		act, err = logTime("2024-05-06T07:08:09+00:00", now)
+		So(err, ShouldBeNil)
+		So(act.Year(), ShouldEqual, 2024)
+
+		_, err = logTime("yesterday", now)
+		So(err, ShouldNotBeNil)
+	})
+}
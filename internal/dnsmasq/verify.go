@@ -0,0 +1,274 @@
+package dnsmasq
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	addnHosts   = "addn-hosts="
+	noAddress   = "no address"
+	passThrough = "pass-through"
+	qA          = "A"
+	qAAAA       = "AAAA"
+)
+
+// Check is the resolver's answer to one query for a sampled domain
+type Check struct {
+	Domain string
+	Qtype  string // A or AAAA
+	Expect string // the redirect IP, "no address" or "pass-through"
+	Got    string
+	OK     bool
+}
+
+// String returns a one line description of a check
+func (c Check) String() string {
+	return fmt.Sprintf("%s %s: expected %s, got %s", c.Domain, c.Qtype, c.Expect, c.Got)
+}
+
+// Report is the result of verifying a sample of blocked and excluded domains against a resolver
+type Report struct {
+	Server string
+	Checks []Check
+}
+
+// Mismatches returns the checks whose answers didn't match
+func (r *Report) Mismatches() (m []Check) {
+	for _, c := range r.Checks {
+		if !c.OK {
+			m = append(m, c)
+		}
+	}
+	return m
+}
+
+// String summarizes a report
+func (r *Report) String() string {
+	return fmt.Sprintf("Verified %d answers from %s, %d mismatched", len(r.Checks), r.Server, len(r.Mismatches()))
+}
+
+// expectations are the answers expected for each blocked domain by query type, and the excluded domains
+type expectations struct {
+	blocked  map[string]map[string]string
+	excluded map[string]bool
+	sinkhole map[string]bool // redirect IPs, which an excluded domain must never resolve to
+}
+
+// add records what a rule means for the resolver's answers
+func (e *expectations) add(r Rule) {
+	switch {
+	case r.Kind == server && r.Value == wildcard:
+		e.excluded[r.Domain] = true
+		return
+	case r.Kind == server:
+		return
+	}
+
+	if e.blocked[r.Domain] == nil {
+		e.blocked[r.Domain] = make(map[string]string)
+	}
+	want := e.blocked[r.Domain]
+
+	switch {
+	case r.Kind == local, r.Value == "":
+		want[qA], want[qAAAA] = noAddress, noAddress
+	case r.Value == wildcard:
+		want[qA], want[qAAAA] = "0.0.0.0", "::"
+	case r.family() == "4":
+		want[qA] = r.Value
+	case r.family() == "6":
+		want[qAAAA] = r.Value
+	}
+
+	for _, ip := range []string{want[qA], want[qAAAA]} {
+		if ip != "" && ip != noAddress {
+			e.sinkhole[net.ParseIP(ip).String()] = true
+		}
+	}
+}
+
+// addHosts records the entries of an addn-hosts file as address= rules
+func (e *expectations) addHosts(file string) error {
+	f, err := os.Open(file) // nolint
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b := bufio.NewScanner(f)
+	for b.Scan() {
+		fields := strings.Fields(b.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || net.ParseIP(fields[0]) == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			e.add(Rule{Kind: address, Domain: strings.ToLower(name), Value: fields[0]})
+		}
+	}
+	return b.Err()
+}
+
+// load reads the blocking and excluding rules from dnsmasq files, following their addn-hosts files
+func (e *expectations) load(files []string) error {
+	for _, file := range files {
+		f, err := os.Open(file) // nolint
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return err
+		}
+
+		b := bufio.NewScanner(f)
+		b.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for b.Scan() {
+			line := strings.TrimSpace(b.Text())
+			if strings.HasPrefix(line, addnHosts) {
+				if err = e.addHosts(strings.TrimPrefix(line, addnHosts)); err != nil {
+					break
+				}
+				continue
+			}
+
+			kind, domains, value := parseRules(line)
+			for _, d := range domains {
+				if d != "" {
+					e.add(Rule{Kind: kind, Domain: strings.ToLower(d), Value: value})
+				}
+			}
+		}
+
+		if err == nil {
+			err = b.Err()
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sample returns up to n domains picked at random, sorted
+func sample(domains []string, n int) []string {
+	if len(domains) > n {
+		rand.Shuffle(len(domains), func(i, j int) { domains[i], domains[j] = domains[j], domains[i] })
+		domains = domains[:n]
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// query asks the resolver for the A or AAAA addresses of a domain
+func query(r *net.Resolver, domain, qtype string) ([]net.IP, error) {
+	network := "ip4"
+	if qtype == qAAAA {
+		network = "ip6"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ips, err := r.LookupIP(ctx, network, domain+".")
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	return ips, err
+}
+
+// check compares the resolver's answer with the expected one
+func (e *expectations) check(r *net.Resolver, domain, qtype, expect string) Check {
+	c := Check{Domain: domain, Qtype: qtype, Expect: expect}
+
+	ips, err := query(r, domain, qtype)
+	if err != nil {
+		c.Got = err.Error()
+		return c
+	}
+
+	c.Got = noAddress
+	if len(ips) > 0 {
+		got := make([]string, len(ips))
+		for i, ip := range ips {
+			got[i] = ip.String()
+		}
+		c.Got = strings.Join(got, ",")
+	}
+
+	switch expect {
+	case noAddress:
+		c.OK = len(ips) < 1
+	case passThrough:
+		c.OK = true
+		for _, ip := range ips {
+			if e.sinkhole[ip.String()] {
+				c.OK = false
+			}
+		}
+	default:
+		c.OK = len(ips) > 0
+		for _, ip := range ips {
+			if !ipOK(expect, ip.String()) {
+				c.OK = false
+			}
+		}
+	}
+	return c
+}
+
+// Verify samples up to n blocked and n excluded domains from dnsmasq files, queries server directly
+// for their A and AAAA records and checks blocked domains get their redirect and excluded domains pass through
+func Verify(server string, files []string, n int) (*Report, error) {
+	e := &expectations{
+		blocked:  make(map[string]map[string]string),
+		excluded: make(map[string]bool),
+		sinkhole: make(map[string]bool),
+	}
+	if err := e.load(files); err != nil {
+		return nil, err
+	}
+
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+
+	var blocked, excluded []string
+	for d := range e.blocked {
+		if !e.excluded[d] {
+			blocked = append(blocked, d)
+		}
+	}
+	for d := range e.excluded {
+		excluded = append(excluded, d)
+	}
+
+	rpt := &Report{Server: server}
+	for _, d := range sample(blocked, n) {
+		for _, qtype := range []string{qA, qAAAA} {
+			if expect := e.blocked[d][qtype]; expect != "" {
+				rpt.Checks = append(rpt.Checks, e.check(r, d, qtype, expect))
+			}
+		}
+	}
+
+	for _, d := range sample(excluded, n) {
+		for _, qtype := range []string{qA, qAAAA} {
+			rpt.Checks = append(rpt.Checks, e.check(r, d, qtype, passThrough))
+		}
+	}
+	return rpt, nil
+}
@@ -0,0 +1,152 @@
+package dnsmasq
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// standIn answers A and AAAA queries from a map of domain to addresses, with NXDOMAIN for unknown domains
+func standIn(t *testing.T, answers map[string][]string) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := answer(buf[:n], answers); resp != nil {
+				_, _ = conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+// answer builds the response to a DNS query
+func answer(q []byte, answers map[string][]string) []byte {
+	if len(q) < 12 {
+		return nil
+	}
+
+	var (
+		labels []string
+		i      = 12
+	)
+	for i < len(q) && q[i] != 0 {
+		l := int(q[i])
+		labels = append(labels, string(q[i+1:i+1+l]))
+		i += l + 1
+	}
+	qtype := binary.BigEndian.Uint16(q[i+1:])
+	question := q[12 : i+5]
+
+	var (
+		count uint16
+		rr    []byte
+	)
+	ips, ok := answers[strings.ToLower(strings.Join(labels, "."))]
+	for _, s := range ips {
+		ip := net.ParseIP(s)
+		rdata := ip.To4()
+		if qtype == 28 {
+			if rdata != nil {
+				continue
+			}
+			rdata = ip.To16()
+		} else if rdata == nil {
+			continue
+		}
+		r := []byte{0xc0, 12, 0, byte(qtype), 0, 1, 0, 0, 0, 60, 0, byte(len(rdata))}
+		rr = append(append(rr, r...), rdata...)
+		count++
+	}
+
+	flags := uint16(0x8180)
+	if !ok {
+		flags |= 3 // NXDOMAIN
+	}
+
+	resp := make([]byte, 12)
+	copy(resp, q[:2])
+	binary.BigEndian.PutUint16(resp[2:], flags)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], count)
+	return append(append(resp, question...), rr...)
+}
+
+func TestVerify(t *testing.T) {
+	Convey("Testing Verify()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testVerify")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		hosts := filepath.Join(dir, "hosts.ads.hosts")
+		for f, data := range map[string]string{
+			"domains.ads.blacklist.conf": strings.Join([]string{
+				"address=/ads.example.com/0.0.0.0",
+				"address=/ads.example.com/::",
+				"address=/tracker.example.com/0.0.0.0",
+				"local=/malware.example.com/",
+				"",
+			}, "\n"),
+			"domains.whitelisted-servers.blacklist.conf": "server=/good.example.com/#\nserver=/leaky.example.com/#\n",
+			"hosts.ads.blacklist.conf":                   "addn-hosts=" + hosts + "\n",
+			"hosts.ads.hosts":                            "0.0.0.0 banner.example.com\n",
+		} {
+			So(ioutil.WriteFile(filepath.Join(dir, f), []byte(data), 0o644), ShouldBeNil)
+		}
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.blacklist.conf"))
+		So(err, ShouldBeNil)
+		files = append(files, filepath.Join(dir, "missing.blacklist.conf"))
+
+		srv, stop := standIn(t, map[string][]string{
+			"ads.example.com":     {"0.0.0.0", "::"},
+			"tracker.example.com": {"93.184.216.34"},
+			"banner.example.com":  {"0.0.0.0"},
+			"good.example.com":    {"93.184.216.34", "2606:2800:220:1::"},
+			"leaky.example.com":   {"0.0.0.0"},
+		})
+		defer stop()
+
+		r, err := Verify(srv, files, 10)
+		So(err, ShouldBeNil)
+
+		var act []string
+		for _, c := range r.Checks {
+			if !c.OK {
+				act = append(act, c.String())
+			}
+		}
+		So(act, ShouldResemble, []string{
+			"tracker.example.com A: expected 0.0.0.0, got 93.184.216.34",
+			"leaky.example.com A: expected pass-through, got 0.0.0.0",
+		})
+		So(len(r.Checks), ShouldEqual, 10)
+		So(r.String(), ShouldEqual, "Verified 10 answers from "+srv+", 2 mismatched")
+		So(len(r.Mismatches()), ShouldEqual, 2)
+
+		Convey("with a sample smaller than the lists", func() {
+			r, err := Verify(srv, files, 1)
+			So(err, ShouldBeNil)
+
+			domains := make(map[string]bool)
+			for _, c := range r.Checks {
+				domains[c.Domain] = true
+			}
+			So(len(domains), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,94 @@
+package edgeos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errNoCache is returned when a source has no usable last-known-good copy
+var errNoCache = errors.New("no cache directory configured")
+
+// cacheFile returns the path of a source's last-known-good copy
+func (s *source) cacheFile() string {
+	return filepath.Join(s.CacheDir, fmt.Sprintf("%s.%s.cache", s.area(), s.name))
+}
+
+// fromCache loads a source's last-known-good copy, returning err if there isn't a usable one
+func (s *source) fromCache(err error) *source {
+	b, age, cerr := s.loadCache()
+	if cerr != nil {
+		switch {
+		case s.Offline:
+			s.Log.Warningf("%s: offline and %v", s.name, cerr)
+			err = cerr
+		case errors.Is(err, errNoData):
+			err = nil
+		}
+		s.r, s.err = bytes.NewReader([]byte{}), err
+		return s
+	}
+
+	switch {
+	case s.Offline:
+		s.Log.Infof("%s: offline, using copy cached %s ago", s.name, age.Round(time.Second))
+	default:
+		s.Log.Warningf("%s: download failed, using last-known-good copy cached %s ago", s.name, age.Round(time.Second))
+	}
+
+	s.served = s.cacheFile()
+	s.r, s.err = bytes.NewReader(b), nil
+	return s
+}
+
+// loadCache reads a source's last-known-good copy and returns its age
+func (s *source) loadCache() ([]byte, time.Duration, error) {
+	if s.CacheDir == "" {
+		return nil, 0, errNoCache
+	}
+
+	f := s.cacheFile()
+	info, err := os.Stat(f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("no cached copy of %s: %v", s.name, err)
+	}
+
+	age := time.Since(info.ModTime())
+	if s.CacheAge > 0 && age > s.CacheAge {
+		return nil, age, fmt.Errorf("cached copy of %s is %s old, exceeding the maximum age of %s", s.name, age.Round(time.Second), s.CacheAge)
+	}
+
+	// nolint
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return nil, age, err
+	}
+	return b, age, nil
+}
+
+// saveCache persists b as a source's last-known-good copy, touching rather than rewriting unchanged copies
+func (s *source) saveCache(b []byte) error {
+	if s.CacheDir == "" {
+		return nil
+	}
+
+	f := s.cacheFile()
+	// nolint
+	if old, err := os.ReadFile(f); err == nil && bytes.Equal(old, b) {
+		now := time.Now()
+		return os.Chtimes(f, now, now)
+	}
+
+	if err := os.MkdirAll(s.CacheDir, 0o755); err != nil {
+		return err
+	}
+
+	tmp := f + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f)
+}
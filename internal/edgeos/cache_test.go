@@ -0,0 +1,105 @@
+package edgeos
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCache(t *testing.T) {
+	Convey("Testing the last-known-good source cache", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		up := true
+		srv := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if !up {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				fmt.Fprint(w, "cached.example.com")
+			},
+		))
+		defer srv.Close()
+
+		newSrc := func(env *Env) *source {
+			return &source{Env: env, name: "lkg", nType: domn, url: srv.URL}
+		}
+		read := func(s *source) string {
+			b, err := io.ReadAll(s.r)
+			So(err, ShouldBeNil)
+			return string(b)
+		}
+
+		env := &Env{CacheAge: time.Hour, CacheDir: dir + "/cache", Log: newLog(), Method: "GET"}
+
+		Convey("with a successful download saving a copy", func() {
+			o := download(newSrc(env))
+			So(o.err, ShouldBeNil)
+			So(read(o), ShouldEqual, "cached.example.com")
+
+			b, err := ioutil.ReadFile(dir + "/cache/domains.lkg.cache")
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "cached.example.com")
+
+			Convey("and a failed download falling back to it", func() {
+				up = false
+				o := download(newSrc(env))
+				So(o.err, ShouldBeNil)
+				So(o.served, ShouldEqual, dir+"/cache/domains.lkg.cache")
+				So(read(o), ShouldEqual, "cached.example.com")
+			})
+
+			Convey("and offline mode using it without downloading", func() {
+				up = false
+				off := *env
+				off.Offline = true
+				o := download(newSrc(&off))
+				So(o.err, ShouldBeNil)
+				So(read(o), ShouldEqual, "cached.example.com")
+			})
+
+			Convey("and a copy older than the maximum age being ignored", func() {
+				up = false
+				old := time.Now().Add(-2 * time.Hour)
+				So(os.Chtimes(dir+"/cache/domains.lkg.cache", old, old), ShouldBeNil)
+				o := download(newSrc(env))
+				So(o.err, ShouldNotBeNil)
+				So(strings.HasPrefix(o.err.Error(), "unexpected HTTP status"), ShouldBeTrue)
+				So(read(o), ShouldEqual, "")
+			})
+
+			Convey("and an unchanged download only refreshing its age", func() {
+				old := time.Now().Add(-30 * time.Minute)
+				So(os.Chtimes(dir+"/cache/domains.lkg.cache", old, old), ShouldBeNil)
+				So(download(newSrc(env)).err, ShouldBeNil)
+				info, err := os.Stat(dir + "/cache/domains.lkg.cache")
+				So(err, ShouldBeNil)
+				So(time.Since(info.ModTime()), ShouldBeLessThan, time.Minute)
+			})
+		})
+
+		Convey("with offline mode and no cached copy", func() {
+			off := *env
+			off.Offline = true
+			o := download(newSrc(&off))
+			So(o.err, ShouldNotBeNil)
+			So(o.err.Error(), ShouldStartWith, "no cached copy of lkg")
+		})
+
+		Convey("with offline mode and no cache directory", func() {
+			o := download(newSrc(&Env{Log: newLog(), Offline: true}))
+			So(o.err, ShouldEqual, errNoCache)
+		})
+	})
+}
@@ -0,0 +1,192 @@
+package edgeos
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	dnsOpts    = regexp.MustCompile(`(?m)^Compile time options:(.*)$`)
+	dnsVersion = regexp.MustCompile(`(?i)dnsmasq version (\d+)\.(\d+)`)
+)
+
+// blockTest is the domain a blocking mode's directive is tried with
+const blockTest = "blacklist.test"
+
+// dnsCaps is the version and compile time options of the installed dnsmasq
+type dnsCaps struct {
+	major, minor int
+	opts         map[string]bool
+	test         func(mode string) error // tries a blocking mode's directive with dnsmasq, nil to skip
+	tested       map[string]error
+}
+
+// parseCaps reads the version and compile time options from dnsmasq --version output
+func parseCaps(out string) (*dnsCaps, error) {
+	v := dnsVersion.FindStringSubmatch(out)
+	if v == nil {
+		return nil, fmt.Errorf("unable to read dnsmasq version from %q", strings.SplitN(out, "\n", 2)[0])
+	}
+
+	d := &dnsCaps{opts: make(map[string]bool)}
+	d.major, _ = strconv.Atoi(v[1])
+	d.minor, _ = strconv.Atoi(v[2])
+
+	if o := dnsOpts.FindStringSubmatch(out); o != nil {
+		for _, opt := range strings.Fields(o[1]) {
+			d.opts[opt] = true
+		}
+	}
+	return d, nil
+}
+
+// String returns the dnsmasq version
+func (d *dnsCaps) String() string {
+	return fmt.Sprintf("dnsmasq %d.%d", d.major, d.minor)
+}
+
+// atLeast reports whether dnsmasq is version major.minor or newer
+func (d *dnsCaps) atLeast(major, minor int) bool {
+	return d.major > major || d.major == major && d.minor >= minor
+}
+
+// supports returns an error if dnsmasq can't handle an output option
+func (d *dnsCaps) supports(opt string) error {
+	switch opt {
+	case ipsets:
+		if !d.opts["ipset"] {
+			return fmt.Errorf("%v was built without ipset support", d)
+		}
+	case nftsets:
+		if !d.atLeast(2, 87) {
+			return fmt.Errorf("%v is older than 2.87, the first release with nftset support", d)
+		}
+		if !d.opts["nftset"] {
+			return fmt.Errorf("%v was built without nftset support", d)
+		}
+	case blackhole6:
+		if d.opts["no-IPv6"] {
+			return fmt.Errorf("%v was built without IPv6 support", d)
+		}
+	case modeLocal, modeNXDomain:
+		if d.test == nil {
+			return nil
+		}
+		if d.tested == nil {
+			d.tested = make(map[string]error)
+		}
+		if _, ok := d.tested[opt]; !ok {
+			d.tested[opt] = d.test(opt)
+		}
+		return d.tested[opt]
+	}
+	return nil
+}
+
+// dnsmasqCaps runs the DNSver command and returns the installed dnsmasq's capabilities,
+// or nil if there's no dnsmasq to ask
+func (c *Config) dnsmasqCaps() (*dnsCaps, error) {
+	args := strings.Fields(c.DNSver)
+	if len(args) < 1 {
+		return nil, nil
+	}
+
+	if _, err := exec.LookPath(args[0]); err != nil {
+		c.Debug(fmt.Sprintf("%s not found, skipping dnsmasq capability checks", args[0]))
+		return nil, nil
+	}
+
+	cmd := exec.Command(args[0], args[1:]...) // nolint
+	cmd.Stdin = strings.NewReader("")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read dnsmasq capabilities: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	d, err := parseCaps(string(out))
+	if d != nil {
+		d.test = c.testMode
+	}
+	return d, err
+}
+
+// testMode returns an error if the DNStest command rejects the directive blockFormat writes for a blocking
+// mode, since the modes dnsmasq accepts vary by release; the test is skipped without a DNStest command
+func (c *Config) testMode(mode string) error {
+	args := strings.Fields(c.DNStest)
+	if len(args) < 1 || c.Pfx.domain == "" {
+		return nil
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil
+	}
+
+	line := fmt.Sprintf(blockFormat(&source{Env: c.Env, mode: mode}), blockTest)
+	if out, err := runDNStest(args, line+"\n"); err != nil {
+		return fmt.Errorf("dnsmasq rejects %q: %s", line, out)
+	}
+	return nil
+}
+
+// CheckCaps returns an error if the installed dnsmasq can't handle a node or source's output options
+// or blocking mode
+func (c *Config) CheckCaps() error {
+	d, err := c.dnsmasqCaps()
+	if d == nil {
+		return err
+	}
+	c.Debug(fmt.Sprintf("Using %v with options %v", d, d.opts))
+
+	for _, node := range []string{rootNode, domains, hosts} {
+		if !c.tree.keyExists(node) {
+			continue
+		}
+
+		for _, s := range append([]*source{c.tree[node]}, c.tree[node].src...) {
+			ipset, nftset, ip6, mode, out := s.ipset, s.nftset, s.ip6, s.mode, s.output
+			if ipset == "" {
+				ipset = c.tree.getIPSet(node)
+			}
+			if nftset == "" {
+				nftset = c.tree.getNFTSet(node)
+			}
+			if ip6 == "" {
+				ip6 = c.tree.getIP6(node)
+			}
+			if mode == "" {
+				mode = c.tree.getMode(node)
+			}
+			if out == "" {
+				out = c.tree.getOutput(node)
+			}
+
+			switch out {
+			case rpzOut, unboundOut:
+				continue
+			}
+
+			used := map[string]bool{
+				blackhole6:   ip6 != "" && (mode == "" || mode == modeNullIP),
+				ipsets:       ipset != "",
+				modeLocal:    mode == modeLocal,
+				modeNXDomain: mode == modeNXDomain,
+				nftsets:      nftset != "",
+			}
+			for _, opt := range []string{blackhole6, ipsets, modeLocal, modeNXDomain, nftsets} {
+				if !used[opt] {
+					continue
+				}
+				if err := d.supports(opt); err != nil {
+					if opt == mode {
+						opt = blockMode + " " + mode
+					}
+					return fmt.Errorf("%s for %s can't be used: %v", opt, s.name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	dnsmasq280 = `Dnsmasq version 2.80  Copyright (c) 2000-2018 Simon Kelley
+Compile time options: IPv6 GNU-getopt DBus i18n IDN DHCP DHCPv6 no-Lua TFTP conntrack ipset auth DNSSEC loop-detect inotify dumpfile
+`
+	dnsmasq289 = `Dnsmasq version 2.89  Copyright (c) 2000-2022 Simon Kelley
+Compile time options: IPv6 GNU-getopt DBus no-UBus i18n IDN2 DHCP DHCPv6 no-Lua TFTP conntrack ipset nftset auth cryptohash DNSSEC loop-detect inotify dumpfile
+`
+	dnsmasqTiny = `Dnsmasq version 2.78  Copyright (c) 2000-2017 Simon Kelley
+Compile time options: no-IPv6 GNU-getopt no-DBus no-i18n no-IDN DHCP no-DHCPv6 no-Lua no-TFTP no-conntrack no-ipset no-auth no-DNSSEC loop-detect no-inotify
+`
+)
+
+func TestCaps(t *testing.T) {
+	Convey("Testing dnsmasq capability detection", t, func() {
+		Convey("parsing dnsmasq --version output", func() {
+			d, err := parseCaps(dnsmasq280)
+			So(err, ShouldBeNil)
+			So(d.String(), ShouldEqual, "dnsmasq 2.80")
+			So(d.atLeast(2, 80), ShouldBeTrue)
+			So(d.atLeast(2, 87), ShouldBeFalse)
+			So(d.supports(ipsets), ShouldBeNil)
+			So(d.supports(nftsets).Error(), ShouldEqual, "dnsmasq 2.80 is older than 2.87, the first release with nftset support")
+
+			d, err = parseCaps(dnsmasq289)
+			So(err, ShouldBeNil)
+			So(d.supports(nftsets), ShouldBeNil)
+
+			d, err = parseCaps(dnsmasqTiny)
+			So(err, ShouldBeNil)
+			So(d.supports(ipsets).Error(), ShouldEqual, "dnsmasq 2.78 was built without ipset support")
+			So(d.supports(blackhole6).Error(), ShouldEqual, "dnsmasq 2.78 was built without IPv6 support")
+
+			_, err = parseCaps("dnsmasq: unknown option\n")
+			So(err.Error(), ShouldEqual, `unable to read dnsmasq version from "dnsmasq: unknown option"`)
+		})
+
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		// test is a fake dnsmasq --test that rejects local= directives
+		test := filepath.Join(dir, "dnsmasq-test")
+		So(ioutil.WriteFile(test, []byte(`#!/bin/sh
+for a in "$@"; do
+	case "$a" in
+	--conf-file=*) conf="${a#--conf-file=}" ;;
+	esac
+done
+if grep -q '^local=' "$conf"; then
+	echo "dnsmasq: bad option at line 1 of $conf"
+	exit 1
+fi
+`), 0o755), ShouldBeNil)
+
+		// check loads a configuration and checks it using a fake dnsmasq that prints version
+		check := func(version, cfg string) error {
+			ver := filepath.Join(dir, "dnsmasq-version")
+			So(ioutil.WriteFile(ver, []byte("#!/bin/sh\ncat <<'EOF'\n"+version+"EOF\n"), 0o755), ShouldBeNil)
+
+			c := NewConfig(
+				DNStest(test+" --test"),
+				DNSver(ver+" --version"),
+				Logger(newLog()),
+				OutDir(filepath.Join(dir, "blacklist.out")),
+				Prefix("address=", "server="),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+			return c.CheckCaps()
+		}
+
+		nftCfg := `blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        nftset 4#inet#filter#blacklist
+        source ads {
+            file /tmp/ads.txt
+        }
+    }
+}`
+
+		Convey("with an nftset and dnsmasq 2.80", func() {
+			So(check(dnsmasq280, nftCfg).Error(), ShouldEqual,
+				"nftset for domains can't be used: dnsmasq 2.80 is older than 2.87, the first release with nftset support")
+		})
+
+		Convey("with an nftset and dnsmasq 2.89", func() {
+			So(check(dnsmasq289, nftCfg), ShouldBeNil)
+		})
+
+		Convey("with an IPv6 redirect and dnsmasq without IPv6", func() {
+			So(check(dnsmasqTiny, fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+    %s ::
+    domains {
+        source ads {
+            file /tmp/ads.txt
+        }
+    }
+}`, blackhole6)).Error(), ShouldEqual, "dns-redirect-ipv6 for blacklist can't be used: dnsmasq 2.78 was built without IPv6 support")
+		})
+
+		Convey("with an IPv6 redirect in RPZ output and dnsmasq without IPv6", func() {
+			So(check(dnsmasqTiny, fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+    %s ::
+    output rpz
+}`, blackhole6)), ShouldBeNil)
+		})
+
+		Convey("with a blocking mode dnsmasq rejects", func() {
+			err := check(dnsmasq289, `blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        blocking-mode local
+        source ads {
+            file /tmp/ads.txt
+        }
+    }
+}`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, `blocking-mode local for domains can't be used: dnsmasq rejects "local=/blacklist.test/": dnsmasq: bad option`)
+		})
+
+		Convey("with a blocking mode dnsmasq accepts", func() {
+			So(check(dnsmasq289, `blacklist {
+    dns-redirect-ip 0.0.0.0
+    blocking-mode nxdomain
+}`), ShouldBeNil)
+		})
+
+		Convey("without dnsmasq installed", func() {
+			c := NewConfig(DNSver(filepath.Join(dir, "missing")+" --version"), Logger(newLog()))
+			So(c.Blacklist(&CFGstatic{Cfg: nftCfg}), ShouldBeNil)
+			So(c.CheckCaps(), ShouldBeNil)
+		})
+	})
+}
@@ -26,6 +26,14 @@ func (c *CFile) Remove() error {
 	if err != nil {
 		return err
 	}
+
+	if c.OutDir != "" {
+		out, err := c.readDir(fmt.Sprintf(c.FnFmt, c.OutDir, c.Wildcard.Node, c.Wildcard.Name, c.Ext))
+		if err != nil {
+			return err
+		}
+		d = append(d, out...)
+	}
 	f := diffArray(c.Names, d)
 	c.Debug(fmt.Sprintf("Removing: %v", f))
 	return purgeFiles(f)
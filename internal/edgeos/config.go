@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"sort"
@@ -28,11 +29,16 @@ type ConfLoader interface {
 type Config struct {
 	*Env
 	tree
+	done    []*source           // processed sources, in processing order
+	merged  map[string][]string // lines per node area for the single and sharded layouts
+	sums    map[string]string   // live file checksums taken by Snapshot
+	targets []*target           // dnsmasq instances with their own blacklist files
 }
 
 type ctr struct {
 	*sync.RWMutex
 	stat
+	mirrors map[string]string // source name to the mirror or cached copy that served it
 }
 type stat map[string]*stats
 
@@ -43,19 +49,29 @@ type stats struct {
 }
 
 const (
-	agent     = `curl/7.64.1`
-	all       = "all"
-	blackhole = "dns-redirect-ip"
-	disabled  = "disabled"
-	domains   = "domains"
-	files     = "file"
-	hosts     = "hosts"
-	notknown  = "unknown"
-	preNoun   = "pre-configured"
-	roots     = "roots"
-	rootNode  = "blacklist"
-	src       = "source"
-	urls      = "url"
+	agent      = `edgeos-dnsmasq-blacklist`
+	all        = "all"
+	blackhole  = "dns-redirect-ip"
+	blackhole6 = "dns-redirect-ipv6"
+	bearer     = "bearer-token-file"
+	disabled   = "disabled"
+	domains    = "domains"
+	files      = "file"
+	concat     = "concatenate"
+	failover   = "failover"
+	header     = "header"
+	hosts      = "hosts"
+	mirMode    = "mirror-mode"
+	mirrors    = "mirror"
+	notknown   = "unknown"
+	passwd     = "password"
+	preNoun    = "pre-configured"
+	roots      = "roots"
+	rootNode   = "blacklist"
+	src        = "source"
+	uagent     = "user-agent"
+	urls       = "url"
+	username   = "username"
 
 	// ExcDomns is a string labels for domain exclusions
 	ExcDomns = "whitelisted-subdomains"
@@ -108,13 +124,16 @@ func (c *Config) addExc(n string) *Objects {
 		iface: iface,
 		src: []*source{
 			{
-				Env:   c.Env,
-				desc:  getLtypeDesc(iface.String()),
-				exc:   exc,
-				ip:    c.tree.getIP(n),
-				ltype: ltype,
-				nType: getType(ltype).(ntype),
-				name:  ltype,
+				Env:    c.Env,
+				desc:   getLtypeDesc(iface.String()),
+				exc:    exc,
+				ip:     c.tree.getIP(n),
+				ip6:    c.tree.getIP6(n),
+				ltype:  ltype,
+				mode:   c.tree.getMode(n),
+				nType:  getType(ltype).(ntype),
+				name:   ltype,
+				output: c.tree.getOutput(n),
 			},
 		},
 	}
@@ -148,14 +167,19 @@ func (c *Config) addInc(n string) *source {
 	}
 
 	return &source{
-		Env:   c.Env,
-		desc:  getLtypeDesc(lt),
-		inc:   inc,
-		iface: iface,
-		ip:    c.tree.getIP(n),
-		ltype: lt,
-		nType: nt,
-		name:  lt,
+		Env:    c.Env,
+		desc:   getLtypeDesc(lt),
+		inc:    inc,
+		iface:  iface,
+		ip:     c.tree.getIP(n),
+		ip6:    c.tree.getIP6(n),
+		ipset:  c.tree.getIPSet(n),
+		ltype:  lt,
+		mode:   c.tree.getMode(n),
+		nType:  nt,
+		name:   lt,
+		nftset: c.tree.getNFTSet(n),
+		output: c.tree.getOutput(n),
 	}
 }
 
@@ -178,6 +202,18 @@ func (c *Config) GetTotalStats() (dropped, extracted, kept int32) {
 	return dropped, extracted, kept
 }
 
+// GetMirrorStats returns the mirror or last-known-good copy that served each source not served by its own URL
+func (c *Config) GetMirrorStats() map[string]string {
+	c.ctr.RLock()
+	defer c.ctr.RUnlock()
+
+	m := make(map[string]string, len(c.ctr.mirrors))
+	for k, v := range c.ctr.mirrors {
+		m[k] = v
+	}
+	return m
+}
+
 // NewContent returns a Contenter interface of the requested IFace type
 func (c *Config) NewContent(iface IFace) (Contenter, error) {
 	switch iface {
@@ -287,18 +323,86 @@ func (c *Config) label(name [][]byte, o *source, n string) {
 	switch string(name[1]) {
 	case "description":
 		o.desc = string(name[2])
+	case bearer:
+		o.token = string(name[2])
 	case blackhole:
 		o.ip = string(name[2])
+	case blackhole6:
+		o.ip6 = string(name[2])
+	case blockMode:
+		o.mode = string(name[2])
 	case files:
 		o.file = string(name[2])
 		o.ltype = string(name[1])
 		c.tree[n].src = append(c.tree[n].src, o)
+	case header:
+		o.headers = append(o.headers, string(name[2]))
+	case ipsets:
+		o.ipset = string(name[2])
+	case mirMode:
+		o.mirrorMode = string(name[2])
+	case outputs:
+		o.output = string(name[2])
+	case mirrors:
+		o.mirror = append(o.mirror, string(name[2]))
+	case nftsets:
+		o.nftset = string(name[2])
+	case passwd:
+		o.pass = string(name[2])
 	case "prefix":
 		o.prefix = string(name[2])
+	case uagent:
+		o.agent = string(name[2])
 	case urls:
 		o.ltype = string(name[1])
 		o.url = string(name[2])
 		c.tree[n].src = append(c.tree[n].src, o)
+	case username:
+		o.user = string(name[2])
+	default:
+		o.tls.set(string(name[1]), string(name[2]))
+	}
+}
+
+// nodeLabel sets options that apply to every source within a top node
+func (c *Config) nodeLabel(name [][]byte, n string) {
+	if !isTnode(n) {
+		return
+	}
+
+	switch string(name[1]) {
+	case blackhole6:
+		c.tree[n].ip6 = string(name[2])
+	case blockMode:
+		c.tree[n].mode = string(name[2])
+	case ipsets:
+		c.tree[n].ipset = string(name[2])
+	case layouts:
+		if n == rootNode {
+			c.tree[n].layout = string(name[2])
+		}
+	case nftsets:
+		c.tree[n].nftset = string(name[2])
+	case outputs:
+		c.tree[n].output = string(name[2])
+	case probeFail, probeMethod, probeNetwork, probeTarget:
+		if n == rootNode {
+			c.tree[n].probe.set(string(name[1]), string(name[2]))
+		}
+	case resolverFallback, resolverProto, resolvers:
+		if n == rootNode {
+			c.tree[n].resolver.set(string(name[1]), string(name[2]))
+		}
+	case setDefs:
+		if n == rootNode {
+			c.tree[n].setDefs = string(name[2])
+		}
+	case shardSize:
+		if n == rootNode {
+			c.tree[n].shards = string(name[2])
+		}
+	default:
+		c.tree[n].tls.set(string(name[1]), string(name[2]))
 	}
 }
 
@@ -340,19 +444,57 @@ func (c *Config) sourcename(o *source, line []byte, n string, find *regx.OBJ) {
 	}
 }
 
-// ProcessContent processes the Contents array
+// ProcessContent processes the Contents array and writes each source's file, leaving merged layouts to WriteLayout
 func (c *Config) ProcessContent(cts ...Contenter) error {
+	if len(cts) < 1 {
+		return errors.New("empty Contenter interface{} passed to ProcessContent()")
+	}
+
+	err := c.Process(cts...)
+	if c.Merging() {
+		return err
+	}
+
+	if werr := c.WriteLayout(); werr != nil {
+		if err == nil {
+			return werr
+		}
+		return fmt.Errorf("%v\n%v", err, werr)
+	}
+	return err
+}
+
+// SourceError lists the sources whose content couldn't be fetched; WriteLayout keeps their previous files
+type SourceError struct {
+	Errs []string
+}
+
+// Error implements the error interface
+func (e *SourceError) Error() string {
+	return strings.Join(e.Errs, "\n")
+}
+
+// Process extracts the entries of each Contenter's sources without writing them, so Prune can drop entries
+// already blocked by a parent domain before WriteLayout writes the files
+func (c *Config) Process(cts ...Contenter) error {
 	var (
 		errs []string
 		wg   sync.WaitGroup
 	)
 
 	if len(cts) < 1 {
-		return errors.New("empty Contenter interface{} passed to ProcessContent()")
+		return errors.New("empty Contenter interface{} passed to Process()")
+	}
+
+	if c.Merging() {
+		return c.mergeContent(cts...)
 	}
 
 	for _, ct := range cts {
-		for _, s := range ct.GetList().src {
+		srcs := ct.GetList().src
+		c.done = append(c.done, srcs...)
+
+		for _, s := range srcs {
 			if s.err != nil {
 				errs = append(errs, s.err.Error())
 			}
@@ -363,9 +505,7 @@ func (c *Config) ProcessContent(cts ...Contenter) error {
 				s.ctr.stat[typeInt(s.nType)] = &stats{}
 				s.ctr.Unlock()
 
-				if err := s.process().writeFile(); err != nil {
-					errs = append(errs, err.Error())
-				}
+				s.process()
 				wg.Done()
 			}(s)
 		}
@@ -374,7 +514,7 @@ func (c *Config) ProcessContent(cts ...Contenter) error {
 	wg.Wait()
 
 	if errs != nil {
-		return errors.New(strings.Join(errs, "\n"))
+		return &SourceError{Errs: errs}
 	}
 
 	return nil
@@ -387,13 +527,18 @@ func (c *Config) Blacklist(r ConfLoader) error {
 		find  = regx.NewRegex()
 		nodes []string
 		o     *source
+		tgt   *target
 		tnode string
+		tdeep int
 	)
 
 	for b.Scan() {
 		line := bytes.TrimSpace(b.Bytes())
 		c.Debug(fmt.Sprintf("%s\n", string(line)))
 		switch {
+		case tgt != nil && find.RX[regx.NAME].Match(line): // add target option
+			c.Debug(fmt.Sprintf("Adding option to target %s: %s\n", tgt.name, string(line)))
+			tgt.label(find.SubMatch(regx.NAME, line))
 		case find.RX[regx.MLTI].Match(line): // add include/exclude
 			c.Debug(fmt.Sprintf("Adding incExc to %s: %s\n", tnode, string(line)))
 			c.excinc(find.SubMatch(regx.MLTI, line), tnode)
@@ -406,6 +551,10 @@ func (c *Config) Blacklist(r ConfLoader) error {
 			c.Debug(fmt.Sprintf("Adding leaf to %s: %s\n", tnode, string(line)))
 			srcName := find.SubMatch(regx.LEAF, line)
 			nodes = append(nodes, string(srcName[1]))
+			if string(srcName[1]) == targets && tnode == rootNode {
+				tgt, tdeep = &target{name: string(srcName[2])}, len(nodes)
+				c.targets = append(c.targets, tgt)
+			}
 			o = newSource()
 			o.addSource(srcName, tnode)
 		case find.RX[regx.DSBL].Match(line): // add disable blacklist flag
@@ -414,10 +563,16 @@ func (c *Config) Blacklist(r ConfLoader) error {
 		case find.RX[regx.IPBH].Match(line) && isntSource(nodes): // add blackhole IP
 			c.Debug(fmt.Sprintf("Adding blackhole IP to %s: %s\n", tnode, string(line)))
 			c.redirect(line, tnode, find)
+		case find.RX[regx.NAME].Match(line) && isntSource(nodes): // add top node option
+			c.Debug(fmt.Sprintf("Adding option to %s: %s\n", tnode, string(line)))
+			c.nodeLabel(find.SubMatch(regx.NAME, line), tnode)
 		case find.RX[regx.NAME].Match(line): // add source name
 			c.Debug(fmt.Sprintf("Adding source to %s: %s\n", tnode, string(line)))
 			c.sourcename(o, line, tnode, find)
 		case find.RX[regx.RBRC].Match(line): // found closing bracket
+			if tgt != nil && len(nodes) == tdeep {
+				tgt = nil
+			}
 			if len(nodes) > 1 {
 				c.Debug(fmt.Sprintf("Matching closing bracket: %s\n", string(line)))
 				nodes = nodes[:len(nodes)-1] // pop last node
@@ -430,22 +585,39 @@ func (c *Config) Blacklist(r ConfLoader) error {
 		return errors.New("no blacklist configuration has been detected")
 	}
 
+	if err := c.tree.checkIPs(); err != nil {
+		return err
+	}
+
+	if err := c.tree.checkOutputs(); err != nil {
+		return err
+	}
+
+	if err := c.tree.checkModes(); err != nil {
+		return err
+	}
+
+	if err := c.tree.checkSets(); err != nil {
+		return err
+	}
+
+	if err := c.checkTargets(); err != nil {
+		return err
+	}
+
+	if err := c.setLayout(); err != nil {
+		return err
+	}
+
+	if err := c.checkOutDir(); err != nil {
+		return err
+	}
+
 	c.Debug(fmt.Sprintf("Using router configuration %v", c.String()))
 
 	return nil
 }
 
-// ReloadDNS reloads the dnsmasq configuration
-func (c *Config) ReloadDNS() ([]byte, error) {
-	// nolint
-	bcmd := c.Bash
-	dnssvc := c.DNSsvc
-	c = nil // workaround to release memory for ER-X
-	cmd := exec.Command(bcmd)
-	cmd.Stdin = strings.NewReader(dnssvc)
-	return cmd.CombinedOutput()
-}
-
 // sortKeys returns a slice of keys in lexicographical sorted order.
 func (c *Config) sortKeys() (pkeys sort.StringSlice) {
 	pkeys = make(sort.StringSlice, len(c.tree))
@@ -476,6 +648,29 @@ func (c *Config) String() (s string) {
 
 		s += fmt.Sprintf("%v%q: %q,\n", tabs(indent), disabled, booltoStr(c.tree[pkey].disabled))
 		s = is(indent, s, "ip", c.tree[pkey].ip)
+		s = is(indent, s, "ipv6", c.tree[pkey].ip6)
+		s = is(indent, s, blockMode, c.tree[pkey].mode)
+		s = is(indent, s, outputs, c.tree[pkey].output)
+		s = is(indent, s, ipsets, c.tree[pkey].ipset)
+		s = is(indent, s, nftsets, c.tree[pkey].nftset)
+		s = is(indent, s, setDefs, c.tree[pkey].setDefs)
+		s = is(indent, s, layouts, c.tree[pkey].layout)
+		s = is(indent, s, shardSize, c.tree[pkey].shards)
+		s = is(indent, s, caFile, c.tree[pkey].tls.ca)
+		s = is(indent, s, insecure, c.tree[pkey].tls.insecure)
+		s = is(indent, s, spkiPin, c.tree[pkey].tls.pin)
+		s = is(indent, s, tlsMin, c.tree[pkey].tls.minVer)
+		s = is(indent, s, probeFail, c.tree[pkey].probe.failure)
+		s = is(indent, s, probeMethod, c.tree[pkey].probe.method)
+		s = is(indent, s, probeNetwork, c.tree[pkey].probe.network)
+		if len(c.tree[pkey].probe.targets) > 0 {
+			s += getJSONArray(&cfgJSON{array: c.tree[pkey].probe.targets, pk: pkey, leaf: probeTarget, indent: indent})
+		}
+		s = is(indent, s, resolverFallback, c.tree[pkey].resolver.fallback)
+		s = is(indent, s, resolverProto, c.tree[pkey].resolver.proto)
+		if len(c.tree[pkey].resolver.servers) > 0 {
+			s += getJSONArray(&cfgJSON{array: c.tree[pkey].resolver.servers, pk: pkey, leaf: resolvers, indent: indent})
+		}
 		s += getJSONArray(&cfgJSON{array: c.tree[pkey].exc, pk: pkey, leaf: "excludes", indent: indent})
 		s += getJSONArray(&cfgJSON{array: c.tree[pkey].inc, pk: pkey, leaf: "includes", indent: indent})
 		s += getJSONsrcArray(&cfgJSON{Config: c, pk: pkey, indent: indent})
@@ -499,12 +694,69 @@ func (c tree) getIP(node string) string {
 	return "0.0.0.0"
 }
 
+func (c tree) getIP6(node string) string {
+	if c.keyExists(node) && c[node].ip6 != "" {
+		return c[node].ip6
+	}
+	if c.keyExists(rootNode) {
+		return c[rootNode].ip6
+	}
+	return ""
+}
+
+// checkIPs returns an error if a node or source redirect address isn't a valid IP address
+func (c tree) checkIPs() error {
+	for _, node := range []string{rootNode, domains, hosts} {
+		if !c.keyExists(node) {
+			continue
+		}
+
+		for _, s := range append([]*source{c[node]}, c[node].src...) {
+			if s.ip != "" && net.ParseIP(s.ip) == nil {
+				return fmt.Errorf("invalid %s %q for %s, must be an IPv4 or IPv6 address", blackhole, s.ip, s.name)
+			}
+			if ip := net.ParseIP(s.ip6); s.ip6 != "" && (ip == nil || !strings.Contains(s.ip6, ":")) {
+				return fmt.Errorf("invalid %s %q for %s, must be an IPv6 address", blackhole6, s.ip6, s.name)
+			}
+		}
+	}
+	return nil
+}
+
+func (c tree) getTLS(node string) tlsOpts {
+	var t tlsOpts
+	if c.keyExists(node) {
+		t = c[node].tls
+	}
+	if c.keyExists(rootNode) {
+		t = t.inherit(c[rootNode].tls)
+	}
+	return t
+}
+
 func (c tree) validate(node string) *Objects {
 	if c.keyExists(node) {
 		for _, o := range c[node].src {
 			if o.ip == "" {
 				o.ip = c.getIP(node)
 			}
+			if o.ip6 == "" {
+				o.ip6 = c.getIP6(node)
+			}
+			if o.mode == "" {
+				o.mode = c.getMode(node)
+			}
+			if o.output == "" {
+				o.output = c.getOutput(node)
+			}
+			if o.ipset == "" {
+				o.ipset = c.getIPSet(node)
+			}
+			if o.nftset == "" {
+				o.nftset = c.getNFTSet(node)
+			}
+			o.tls = o.tls.inherit(c.getTLS(node))
+			o.resolver = c.getResolver()
 		}
 		return &c[node].Objects
 	}
@@ -323,6 +323,62 @@ func TestGetIP(t *testing.T) {
 	})
 }
 
+func TestGetIP6(t *testing.T) {
+	Convey("Testing IPv6 redirect inheritance", t, func() {
+		cfg := `blacklist {
+    dns-redirect-ip 0.0.0.0
+    dns-redirect-ipv6 ::
+    domains {
+        dns-redirect-ipv6 fd00::1
+        source ads {
+            url https://lists.example.com/ads.txt
+        }
+    }
+    hosts {
+        source local {
+            dns-redirect-ipv6 fd00::2
+            url https://lists.example.com/hosts.txt
+        }
+        source tracking {
+            url https://lists.example.com/tracking.txt
+        }
+    }
+}`
+		c := NewConfig()
+		So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+
+		So(c.Get(domains).Filter(urls).src[0].ip6, ShouldEqual, "fd00::1")
+		h := c.Get(hosts).Filter(urls).src
+		So(h[0].ip6, ShouldEqual, "fd00::2")
+		So(h[1].ip6, ShouldEqual, "::")
+		So(c.addExc(domains).src[0].ip6, ShouldEqual, "fd00::1")
+		So(tree{}.getIP6(domains), ShouldEqual, "")
+
+		tests := []struct {
+			err  string
+			leaf string
+		}{
+			{leaf: "dns-redirect-ip 10.0.0.300", err: `invalid dns-redirect-ip "10.0.0.300" for ads, must be an IPv4 or IPv6 address`},
+			{leaf: "dns-redirect-ipv6 10.0.0.1", err: `invalid dns-redirect-ipv6 "10.0.0.1" for ads, must be an IPv6 address`},
+			{leaf: "dns-redirect-ipv6 fd00::zz", err: `invalid dns-redirect-ipv6 "fd00::zz" for ads, must be an IPv6 address`},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.leaf, func() {
+				cfg := fmt.Sprintf(`blacklist {
+    domains {
+        source ads {
+            %s
+            url https://lists.example.com/ads.txt
+        }
+    }
+}`, tt.leaf)
+				So(NewConfig().Blacklist(&CFGstatic{Cfg: cfg}).Error(), ShouldEqual, tt.err)
+			})
+		}
+	})
+}
+
 func TestFiles(t *testing.T) {
 	Convey("Testing c.GetAll().Files()", t, func() {
 		r := &CFGstatic{Cfg: tdata.Cfg}
@@ -352,6 +408,48 @@ func TestFiles(t *testing.T) {
 	})
 }
 
+func TestHTTPSourceOptions(t *testing.T) {
+	Convey("Testing HTTP source options are loaded", t, func() {
+		cfg := `blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        source premium {
+            bearer-token-file /config/auth/premium.token
+            description "Commercial feed"
+            header "X-Api-Key: abc123"
+            header "Accept: text/plain"
+            url https://feeds.example.com/domains.txt
+            user-agent "Mozilla/5.0"
+        }
+        source private {
+            mirror https://mirror1.example.com/domains.txt
+            mirror https://mirror2.example.com/domains.txt
+            mirror-mode concatenate
+            password pa55
+            url https://lists.example.com/domains.txt
+            username jdoe
+        }
+    }
+}`
+		c := NewConfig()
+		So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+
+		src := c.tree[domains].src
+		So(len(src), ShouldEqual, 2)
+		So(src[0].token, ShouldEqual, "/config/auth/premium.token")
+		So(src[0].headers, ShouldResemble, []string{"X-Api-Key: abc123", "Accept: text/plain"})
+		So(src[0].agent, ShouldEqual, "Mozilla/5.0")
+		So(src[1].user, ShouldEqual, "jdoe")
+		So(src[1].pass, ShouldEqual, "pa55")
+		So(src[1].mirrorMode, ShouldEqual, concat)
+		So(src[1].locations(), ShouldResemble, []string{
+			"https://lists.example.com/domains.txt",
+			"https://mirror1.example.com/domains.txt",
+			"https://mirror2.example.com/domains.txt",
+		})
+	})
+}
+
 func TestInSession(t *testing.T) {
 	Convey("Testing InSession()", t, func() {
 		c := NewConfig()
@@ -438,7 +536,8 @@ func TestReloadDNS(t *testing.T) {
 	Convey("Testing ReloadDNS()", t, func() {
 		act, err := NewConfig(Bash("/bin/bash"), DNSsvc("true")).ReloadDNS()
 		So(err, ShouldBeNil)
-		So(string(act), ShouldEqual, "")
+		So(string(act.Out), ShouldEqual, "")
+		So(act.Strategy, ShouldEqual, ReloadRestart)
 	})
 }
 
@@ -25,6 +25,7 @@ const (
 )
 
 type bList struct {
+	data *bList // companion data file referenced by file
 	file string
 	r    io.Reader
 	size int
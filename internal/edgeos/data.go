@@ -77,14 +77,33 @@ func formatData(s string, l *list) io.Reader {
 	return strings.NewReader(strings.Join(a, ""))
 }
 
-// getDnsmasqPrefix returns the dnsmasq conf file delimiter
+// getDnsmasqPrefix returns the dnsmasq conf file delimiter, followed by any ipset= and nftset= lines
 func getDnsmasqPrefix(s *source) string {
 	switch s.nType {
-	case domn, preDomn, preRoot, root:
-		return s.Pfx.domain + "/%v/" + s.ip
 	case excDomn, excHost, excRoot:
 		return s.Pfx.host + "/%v/#"
 	}
+
+	l := setLines(s)
+	if len(l) < 1 {
+		return blockFormat(s)
+	}
+	if s.mode != modeNone {
+		l = append([]string{strings.Replace(blockFormat(s), "%v", "%[1]v", 1)}, l...)
+	}
+	return strings.Join(l, "\n")
+}
+
+// blockFormat returns the dnsmasq format that blocks a source's entries
+func blockFormat(s *source) string {
+	switch {
+	case s.mode == modeLocal:
+		return "local=/%v/"
+	case s.mode == modeNXDomain:
+		return s.Pfx.domain + "/%v/"
+	case s.ip6 != "":
+		return s.Pfx.domain + "/%[1]v/" + s.ip + "\n" + s.Pfx.domain + "/%[1]v/" + s.ip6
+	}
 	return s.Pfx.domain + "/%v/" + s.ip
 }
 
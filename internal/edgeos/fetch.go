@@ -0,0 +1,173 @@
+package edgeos
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errNoData is returned when a source location responds without any content
+var errNoData = errors.New("no data returned")
+
+// Fetcher retrieves the content of a source location for a URL scheme
+type Fetcher interface {
+	Fetch(*FetchRequest) (io.ReadCloser, error)
+}
+
+// FetcherFunc is an adapter to allow the use of ordinary functions as Fetchers
+type FetcherFunc func(*FetchRequest) (io.ReadCloser, error)
+
+// Fetch calls f(r)
+func (f FetcherFunc) Fetch(r *FetchRequest) (io.ReadCloser, error) {
+	return f(r)
+}
+
+// FetchRequest describes a source location to be fetched
+type FetchRequest struct {
+	Header  http.Header
+	Method  string
+	Name    string
+	Timeout time.Duration
+	URL     *url.URL
+	client  func() (*http.Client, error)
+}
+
+// Client returns an *http.Client configured with the source's TLS settings and the download timeout
+func (r *FetchRequest) Client() (*http.Client, error) {
+	if r.client == nil {
+		return &http.Client{Timeout: r.Timeout}, nil
+	}
+	return r.client()
+}
+
+// fetchers is the registry of Fetchers keyed by URL scheme
+var fetchers = struct {
+	*sync.RWMutex
+	m map[string]Fetcher
+}{
+	RWMutex: &sync.RWMutex{},
+	m: map[string]Fetcher{
+		"":      FetcherFunc(fetchHTTP),
+		"data":  FetcherFunc(fetchData),
+		"file":  FetcherFunc(fetchFile),
+		"http":  FetcherFunc(fetchHTTP),
+		"https": FetcherFunc(fetchHTTP),
+	},
+}
+
+// RegisterFetcher adds or replaces the Fetcher used for a URL scheme
+func RegisterFetcher(scheme string, f Fetcher) {
+	fetchers.Lock()
+	fetchers.m[strings.ToLower(scheme)] = f
+	fetchers.Unlock()
+}
+
+// getFetcher returns the Fetcher registered for a URL scheme
+func getFetcher(scheme string) (Fetcher, error) {
+	fetchers.RLock()
+	f, ok := fetchers.m[strings.ToLower(scheme)]
+	fetchers.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no fetcher registered for URL scheme %q", scheme)
+	}
+	return f, nil
+}
+
+// fetch retrieves u using the Fetcher registered for its scheme and returns the content
+func (s *source) fetch(u string) ([]byte, error) {
+	var (
+		body []byte
+		err  error
+		f    Fetcher
+		rc   io.ReadCloser
+		req  = &FetchRequest{Method: s.Method, Name: s.name, Timeout: s.Timeout, client: s.client}
+	)
+
+	if req.URL, err = url.Parse(u); err != nil {
+		str := fmt.Sprintf("Unable to form request for %s", u)
+		s.Log.Warning(str)
+		return nil, err
+	}
+
+	if f, err = getFetcher(req.URL.Scheme); err != nil {
+		s.Log.Warning(err.Error())
+		return nil, err
+	}
+
+	if req.Header, err = s.header(); err != nil {
+		s.Log.Warning(err.Error())
+		return nil, err
+	}
+
+	if rc, err = f.Fetch(req); err != nil {
+		if isTLSErr(err) {
+			s.Log.Warningf("TLS failure for %s: %v", u, err)
+			return nil, fmt.Errorf("TLS failure for source %s: %w", s.name, err)
+		}
+		str := fmt.Sprintf("Unable to get response for %s", u)
+		s.Log.Warning(str)
+		return nil, err
+	}
+
+	defer func() {
+		if err := rc.Close(); err != nil {
+			s.Log.Warning(err.Error())
+		}
+	}()
+
+	if body, err = io.ReadAll(rc); err != nil {
+		s.Log.Warningf("Unable to read response for %s", u)
+		return nil, err
+	}
+
+	if len(body) < 1 {
+		str := fmt.Sprintf("No data returned for %s", u)
+		s.Log.Warning(str)
+		return nil, errNoData
+	}
+
+	return body, nil
+}
+
+// fetchData is the Fetcher for RFC 2397 data: source locations
+func fetchData(r *FetchRequest) (io.ReadCloser, error) {
+	meta, data, ok := strings.Cut(strings.TrimPrefix(r.URL.String(), r.URL.Scheme+":"), ",")
+	if !ok {
+		return nil, fmt.Errorf("malformed data URL for %s, missing ','", r.Name)
+	}
+
+	if strings.HasSuffix(meta, ";base64") {
+		b, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("malformed base64 data URL for %s: %v", r.Name, err)
+		}
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	s, err := url.PathUnescape(data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed data URL for %s: %v", r.Name, err)
+	}
+	return io.NopCloser(strings.NewReader(s)), nil
+}
+
+// fetchFile is the Fetcher for file:// source locations
+func fetchFile(r *FetchRequest) (io.ReadCloser, error) {
+	p := r.URL.Path
+	switch {
+	case r.URL.Opaque != "":
+		p = r.URL.Opaque
+	case r.URL.Host != "" && r.URL.Host != "localhost":
+		return nil, fmt.Errorf("unsupported file URL host %q for %s", r.URL.Host, r.Name)
+	}
+	// nolint
+	return os.Open(p)
+}
@@ -0,0 +1,77 @@
+package edgeos
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFetchers(t *testing.T) {
+	Convey("Testing download() with registered fetchers", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/domains.txt", []byte("file.example.com\n"), 0o644), ShouldBeNil)
+
+		RegisterFetcher("TEST", FetcherFunc(func(r *FetchRequest) (io.ReadCloser, error) {
+			if r.URL.Opaque == "fail" {
+				return nil, errors.New("test fetcher failed")
+			}
+			return io.NopCloser(strings.NewReader(r.URL.Opaque + ".example.com")), nil
+		}))
+
+		tests := []struct {
+			err  string
+			exp  string
+			name string
+			url  string
+		}{
+			{name: "file://", url: "file://" + dir + "/domains.txt", exp: "file.example.com\n"},
+			{name: "file://localhost", url: "file://localhost" + dir + "/domains.txt", exp: "file.example.com\n"},
+			{name: "file:// remote host", url: "file://remote" + dir + "/domains.txt", err: `unsupported file URL host "remote" for fetched`},
+			{name: "missing file://", url: "file://" + dir + "/missing.txt", err: "open " + dir + "/missing.txt: no such file or directory"},
+			{name: "data:", url: "data:,ads.example.com%0Atrack.example.com", exp: "ads.example.com\ntrack.example.com"},
+			{name: "data: base64", url: "data:text/plain;base64,YWRzLmV4YW1wbGUuY29t", exp: "ads.example.com"},
+			{name: "malformed data:", url: "data:text/plain", err: "malformed data URL for fetched, missing ','"},
+			{name: "malformed base64 data:", url: "data:;base64,!!!", err: "malformed base64 data URL for fetched: illegal base64 data at input byte 0"},
+			{name: "custom scheme", url: "test:custom", exp: "custom.example.com"},
+			{name: "failing custom scheme", url: "test:fail", err: "test fetcher failed"},
+			{name: "unregistered scheme", url: "gopher://example.com/domains", err: `no fetcher registered for URL scheme "gopher"`},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				o := download(&source{Env: &Env{Log: newLog(), Method: "GET"}, name: "fetched", url: tt.url})
+
+				switch tt.err {
+				case "":
+					So(o.err, ShouldBeNil)
+				default:
+					So(o.err, ShouldNotBeNil)
+					So(o.err.Error(), ShouldEqual, tt.err)
+				}
+
+				act, err := io.ReadAll(o.r)
+				So(err, ShouldBeNil)
+				So(string(act), ShouldEqual, tt.exp)
+			})
+		}
+
+		Convey("with a file:// mirror for a dead url", func() {
+			o := download(&source{
+				Env:    &Env{Log: newLog(), Method: "GET"},
+				mirror: []string{"file://" + dir + "/domains.txt"},
+				name:   "fetched",
+				url:    "http://127.0.0.1:808/",
+			})
+			So(o.err, ShouldBeNil)
+			So(o.served, ShouldEqual, "file://"+dir+"/domains.txt")
+		})
+	})
+}
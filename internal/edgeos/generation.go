@@ -0,0 +1,328 @@
+package edgeos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	genDNS      = "dnsmasq"
+	genData     = "data"
+	genManifest = "manifest.json"
+)
+
+// Generation describes a saved set of generated blacklist files
+type Generation struct {
+	ID      int         `json:"generation"`
+	Time    time.Time   `json:"timestamp"`
+	Hash    string      `json:"config hash"`
+	Sum     string      `json:"content hash,omitempty"`
+	Sources []GenSource `json:"sources"`
+	dir     string
+}
+
+// GenSource records how many entries a source contributed to a generation
+type GenSource struct {
+	Name    string `json:"name"`
+	Node    string `json:"node"`
+	Entries int    `json:"entries"`
+}
+
+// Entries returns the total number of entries in a generation
+func (g Generation) Entries() (n int) {
+	for _, s := range g.Sources {
+		n += s.Entries
+	}
+	return n
+}
+
+// configHash returns a short hash of the loaded blacklist configuration
+func (c *Config) configHash() string {
+	sum := sha256.Sum256([]byte(c.String()))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// liveFiles returns the generated dnsmasq, addn-hosts and set files currently in use; Unbound and RPZ
+// output isn't read by dnsmasq, so it's left out
+func (c *Config) liveFiles() (dns, data []string, err error) {
+	if dns, err = filepath.Glob(fmt.Sprintf(c.FnFmt, c.Dir, c.Wildcard.Node, c.Wildcard.Name, c.Ext)); err != nil {
+		return nil, nil, err
+	}
+
+	if c.DataDir != "" {
+		for _, g := range dataGlobs(c.DataDir) {
+			files, err := filepath.Glob(g)
+			if err != nil {
+				return nil, nil, err
+			}
+			data = append(data, files...)
+		}
+	}
+	return dns, data, nil
+}
+
+// contentHash returns a hash of the names and content of the live files saved in a generation
+func contentHash(files map[string][]string) (string, error) {
+	h := sha256.New()
+	for _, sub := range []string{genDNS, genData} {
+		for _, f := range files[sub] {
+			b, err := os.ReadFile(f) // nolint
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "%s/%s %d\n", sub, filepath.Base(f), len(b))
+			h.Write(b)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SaveGeneration copies the live blacklist files and a manifest into a new generation, keeping only the
+// newest GenKeep generations; it returns nil if no file changed since Snapshot or the files are the same
+// as the newest generation's
+func (c *Config) SaveGeneration() (*Generation, error) {
+	if c.GenDir == "" || c.GenKeep < 1 {
+		return nil, nil
+	}
+
+	gens, err := c.Generations()
+	if err != nil {
+		return nil, err
+	}
+
+	if changed, err := c.Changed(); err == nil && len(changed) < 1 && len(gens) > 0 {
+		return nil, nil
+	}
+
+	dns, data, err := c.liveFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]string{genDNS: dns, genData: data}
+	sum, err := contentHash(files)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(gens) > 0 && gens[len(gens)-1].Sum == sum {
+		return nil, nil
+	}
+
+	g := &Generation{ID: 1, Time: time.Now().UTC(), Hash: c.configHash(), Sum: sum}
+	if len(gens) > 0 {
+		g.ID = gens[len(gens)-1].ID + 1
+	}
+
+	for _, s := range c.done {
+		if s.written {
+			g.Sources = append(g.Sources, GenSource{Name: s.name, Node: s.fileArea(), Entries: s.entries})
+		}
+	}
+	sort.Slice(g.Sources, func(i, j int) bool {
+		if g.Sources[i].Node != g.Sources[j].Node {
+			return g.Sources[i].Node < g.Sources[j].Node
+		}
+		return g.Sources[i].Name < g.Sources[j].Name
+	})
+
+	if err = os.MkdirAll(c.GenDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp(c.GenDir, ".generation-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	for sub, files := range files {
+		for _, f := range files {
+			if err = copyFile(f, filepath.Join(tmp, sub, filepath.Base(f))); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	b, err := json.MarshalIndent(g, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(filepath.Join(tmp, genManifest), b, 0o644); err != nil {
+		return nil, err
+	}
+
+	g.dir = filepath.Join(c.GenDir, strconv.Itoa(g.ID))
+	if err = os.Rename(tmp, g.dir); err != nil {
+		return nil, err
+	}
+
+	gens = append(gens, *g)
+	for len(gens) > c.GenKeep {
+		if err = os.RemoveAll(gens[0].dir); err != nil {
+			return g, err
+		}
+		gens = gens[1:]
+	}
+	return g, nil
+}
+
+// Generations returns the saved generations, oldest first
+func (c *Config) Generations() ([]Generation, error) {
+	entries, err := os.ReadDir(c.GenDir)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var gens []Generation
+	for _, e := range entries {
+		id, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(c.GenDir, e.Name())
+		b, err := os.ReadFile(filepath.Join(dir, genManifest))
+		if err != nil {
+			return nil, fmt.Errorf("generation %d has no manifest: %v", id, err)
+		}
+
+		g := Generation{dir: dir}
+		if err = json.Unmarshal(b, &g); err != nil {
+			return nil, fmt.Errorf("generation %d has an invalid manifest: %v", id, err)
+		}
+		g.ID = id
+		gens = append(gens, g)
+	}
+
+	sort.Slice(gens, func(i, j int) bool { return gens[i].ID < gens[j].ID })
+	return gens, nil
+}
+
+// Restore stages a saved generation's files and commits them in place of the live blacklist files,
+// removing files the generation doesn't hold; generation 0 restores the one before the newest
+func (c *Config) Restore(id int) (*Generation, error) {
+	gens, err := c.Generations()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(gens) < 1 {
+		return nil, fmt.Errorf("no blacklist generations saved in %s", c.GenDir)
+	}
+
+	var g *Generation
+	switch id {
+	case 0:
+		if len(gens) < 2 {
+			return nil, errors.New("no earlier blacklist generation to roll back to")
+		}
+		g = &gens[len(gens)-2]
+	default:
+		for i := range gens {
+			if gens[i].ID == id {
+				g = &gens[i]
+			}
+		}
+	}
+
+	if g == nil {
+		return nil, fmt.Errorf("blacklist generation %d not found in %s", id, c.GenDir)
+	}
+
+	if err = c.Begin(); err != nil {
+		return nil, err
+	}
+
+	if err = g.copyTo(genDNS, c.Dir); err == nil && c.DataDir != "" {
+		err = g.copyTo(genData, c.DataDir)
+	}
+	if err == nil {
+		err = c.keepOutput()
+	}
+
+	if err != nil {
+		if rerr := c.Rollback(); rerr != nil {
+			err = fmt.Errorf("%v, %v", err, rerr)
+		}
+		return nil, err
+	}
+	return g, c.Commit()
+}
+
+// keepOutput links the live Unbound and RPZ files into the staged OutDir, since generations only hold the
+// files dnsmasq reads
+func (c *Config) keepOutput() error {
+	live := c.live[2]
+	if live == "" || live == c.live[0] || live == c.live[1] {
+		return nil
+	}
+
+	for _, g := range c.stageGlobs()[live] {
+		files, err := filepath.Glob(g)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if err = os.Link(f, filepath.Join(c.OutDir, filepath.Base(f))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyTo copies a generation's saved files from sub into dir
+func (g *Generation) copyTo(sub, dir string) error {
+	files, err := filepath.Glob(filepath.Join(g.dir, sub, "*"))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err = copyFile(f, filepath.Join(dir, filepath.Base(f))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies src to dst, creating dst's directory
+func copyFile(src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	b := &bList{file: dst, r: r, size: 1}
+	return b.writeFile()
+}
+
+// String returns a one line summary of a generation
+func (g Generation) String() string {
+	return strings.Join([]string{
+		strconv.Itoa(g.ID),
+		g.Time.Local().Format(time.RFC3339),
+		g.Hash,
+		fmt.Sprintf("%d sources", len(g.Sources)),
+		fmt.Sprintf("%d entries", g.Entries()),
+	}, "\t")
+}
@@ -0,0 +1,148 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGenerations(t *testing.T) {
+	Convey("Testing blacklist generations", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			dns  = filepath.Join(dir, "dnsmasq.d")
+			gens = filepath.Join(dir, "generations")
+			src  = filepath.Join(dir, "ads.txt")
+		)
+		So(os.MkdirAll(dns, 0o755), ShouldBeNil)
+
+		// update runs a staged blacklist update with the given source content and saves a generation
+		update := func(data string) *Generation {
+			So(ioutil.WriteFile(src, []byte(data), 0o644), ShouldBeNil)
+
+			c := NewConfig(
+				Dir(dns),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				GenDir(gens),
+				GenKeep(2),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+				WCard(Wildcard{Node: "*s", Name: "*"}),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        source ads {
+            file %s
+        }
+    }
+}`, src)}), ShouldBeNil)
+
+			So(c.Begin(), ShouldBeNil)
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			So(c.Commit(), ShouldBeNil)
+
+			g, err := c.SaveGeneration()
+			So(err, ShouldBeNil)
+			return g
+		}
+
+		read := func() string {
+			b, err := ioutil.ReadFile(filepath.Join(dns, "domains.ads.blacklist.conf"))
+			So(err, ShouldBeNil)
+			return string(b)
+		}
+
+		Convey("with no generations saved", func() {
+			c := NewConfig(Dir(dns), GenDir(gens))
+			g, err := c.Generations()
+			So(err, ShouldBeNil)
+			So(g, ShouldBeEmpty)
+
+			_, err = c.Restore(0)
+			So(err.Error(), ShouldEqual, "no blacklist generations saved in "+gens)
+		})
+
+		Convey("with generations disabled", func() {
+			c := NewConfig(Dir(dns))
+			g, err := c.SaveGeneration()
+			So(err, ShouldBeNil)
+			So(g, ShouldBeNil)
+		})
+
+		Convey("with an update that changes nothing", func() {
+			So(update("one.example.com\n"), ShouldNotBeNil)
+			So(update("one.example.com\n"), ShouldBeNil)
+		})
+
+		Convey("with three updates", func() {
+			So(update("one.example.com\n").ID, ShouldEqual, 1)
+			So(update("two.example.com\n").ID, ShouldEqual, 2)
+			g := update("three.example.com\nfour.example.com\n")
+			So(g.ID, ShouldEqual, 3)
+			So(g.Sources, ShouldResemble, []GenSource{{Name: "ads", Node: domains, Entries: 2}})
+			So(g.Hash, ShouldHaveLength, 12)
+
+			data := filepath.Join(dir, "hosts")
+			c := NewConfig(
+				DataDir(data),
+				Dir(dns),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				GenDir(gens),
+				WCard(Wildcard{Node: "*s", Name: "*"}),
+			)
+
+			all, err := c.Generations()
+			So(err, ShouldBeNil)
+			So(len(all), ShouldEqual, 2)
+			So(all[0].ID, ShouldEqual, 2)
+			So(all[1].Entries(), ShouldEqual, 2)
+			So(all[1].String(), ShouldContainSubstring, "1 sources\t2 entries")
+
+			Convey("rolling back to the previous generation", func() {
+				r, err := c.Restore(0)
+				So(err, ShouldBeNil)
+				So(r.ID, ShouldEqual, 2)
+				So(read(), ShouldEqual, "address=/two.example.com/0.0.0.0\n")
+			})
+
+			Convey("rolling back removes files the generation doesn't hold", func() {
+				So(os.MkdirAll(data, 0o755), ShouldBeNil)
+				for _, f := range []string{filepath.Join(dns, "domains.extra.blacklist.conf"), filepath.Join(data, "hosts.extra.hosts")} {
+					So(ioutil.WriteFile(f, []byte("extra\n"), 0o644), ShouldBeNil)
+				}
+
+				_, err := c.Restore(0)
+				So(err, ShouldBeNil)
+
+				for _, f := range []string{filepath.Join(dns, "domains.extra.blacklist.conf"), filepath.Join(data, "hosts.extra.hosts")} {
+					_, err = os.Stat(f)
+					So(os.IsNotExist(err), ShouldBeTrue)
+				}
+			})
+
+			Convey("rolling back to a named generation", func() {
+				_, err := c.Restore(3)
+				So(err, ShouldBeNil)
+				So(read(), ShouldEqual, "address=/four.example.com/0.0.0.0\naddress=/three.example.com/0.0.0.0\n")
+			})
+
+			Convey("rolling back to a pruned generation", func() {
+				_, err := c.Restore(1)
+				So(err.Error(), ShouldEqual, "blacklist generation 1 not found in "+gens)
+				So(read(), ShouldEqual, "address=/four.example.com/0.0.0.0\naddress=/three.example.com/0.0.0.0\n")
+			})
+		})
+	})
+}
@@ -2,53 +2,155 @@ package edgeos
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 )
 
-// download creates http requests to download data
+// download fetches data from a source's url and mirrors
 func download(s *source) *source {
 	var (
-		body []byte
-		err  error
-		resp *http.Response
-		req  *http.Request
+		body   []byte
+		bodies [][]byte
+		err    error
+		failed []string
+		noData = true
+		served []string
 	)
 
-	if req, err = http.NewRequest(s.Method, s.url, nil); err != nil {
-		str := fmt.Sprintf("Unable to form request for %s", s.url)
-		s.Log.Warning(str)
-		s.r, s.err = bytes.NewReader([]byte{}), err
-		return s
+	if s.Offline {
+		return s.fromCache(nil)
 	}
 
 	s.Log.Info(fmt.Sprintf("Downloading %s source %s", s.area(), s.name))
 
-	req.Header.Set("User-Agent", agent)
-	if resp, err = (&http.Client{}).Do(req); err != nil {
-		str := fmt.Sprintf("Unable to get response for %s", s.url)
-		s.Log.Warning(str)
-		s.r, s.err = bytes.NewReader([]byte{}), err
-		return s
+	for _, u := range s.locations() {
+		if body, err = s.fetch(u); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", u, err))
+			noData = noData && errors.Is(err, errNoData)
+			continue
+		}
+
+		served = append(served, u)
+		bodies = append(bodies, body)
+		if s.mirrorMode != concat {
+			break
+		}
+	}
+
+	if len(bodies) < 1 {
+		// report every location's failure, only ignoring no data if they all returned none
+		if len(failed) > 1 && !noData {
+			err = errors.New(strings.Join(failed, "\n"))
+		}
+		return s.fromCache(err)
+	}
+
+	body = bytes.Join(bodies, []byte("\n"))
+	if err = s.saveCache(body); err != nil {
+		s.Log.Warningf("%s: unable to save last-known-good copy: %v", s.name, err)
+	}
+
+	s.served = strings.Join(served, ", ")
+	s.r, s.err = bytes.NewBuffer(body), nil
+	return s
+}
+
+// fetchHTTP is the Fetcher for http:// and https:// source locations
+func fetchHTTP(r *FetchRequest) (io.ReadCloser, error) {
+	var (
+		client *http.Client
+		err    error
+		req    *http.Request
+		resp   *http.Response
+	)
+
+	if req, err = http.NewRequest(r.Method, r.URL.String(), nil); err != nil {
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+
+	if client, err = r.Client(); err != nil {
+		return nil, err
+	}
+
+	if resp, err = client.Do(req); err != nil {
+		return nil, err
 	}
 
-	body, err = io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected HTTP status %q for %s", resp.Status, r.URL)
+	}
+
+	return resp.Body, nil
+}
+
+// client returns an *http.Client configured with the source's TLS settings and the download timeout
+func (s *source) client() (*http.Client, error) {
+	cfg, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.resolver.validate(); err != nil {
+		return nil, err
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = cfg
+	if len(s.resolver.servers) > 0 {
+		tr.DialContext = s.resolver.dialContext(&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}, "")
+	}
+
+	return &http.Client{Timeout: s.Timeout, Transport: tr}, nil
+}
 
-	if len(body) < 1 {
-		str := fmt.Sprintf("No data returned for %s", s.url)
-		s.Log.Warning(str)
-		s.r, s.err = bytes.NewReader([]byte{}), err
+// header returns the HTTP request headers configured for s
+func (s *source) header() (http.Header, error) {
+	req := &http.Request{Header: make(http.Header)}
+	if err := s.setHeaders(req); err != nil {
+		return nil, err
+	}
+	return req.Header, nil
+}
+
+// setHeaders adds the User-Agent, custom headers and credentials configured for s to req
+func (s *source) setHeaders(req *http.Request) error {
+	ua := agent
+	switch {
+	case s.agent != "":
+		ua = s.agent
+	case s.Agent != "":
+		ua = s.Agent
+	}
+	req.Header.Set("User-Agent", ua)
 
-		if err = resp.Body.Close(); err != nil {
-			s.Log.Warning(err.Error)
+	for _, h := range s.headers {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			return fmt.Errorf("invalid header %q for source %s, expected \"Name: value\"", h, s.name)
 		}
-		return s
+		req.Header.Set(strings.TrimSpace(k), strings.TrimSpace(v))
 	}
 
-	s.r, s.err = bytes.NewBuffer(body), err
-	if err = resp.Body.Close(); err != nil {
-		s.Log.Warning(err.Error)
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.pass)
 	}
-	return s
+
+	if s.token != "" {
+		// nolint
+		b, err := os.ReadFile(s.token)
+		if err != nil {
+			return fmt.Errorf("unable to read bearer token file for source %s: %v", s.name, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+string(bytes.TrimSpace(b)))
+	}
+
+	return nil
 }
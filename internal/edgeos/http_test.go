@@ -3,9 +3,11 @@ package edgeos
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"sync"
 	"testing"
 
@@ -45,7 +47,6 @@ func TestGetHTTP(t *testing.T) {
 			{ok: false, err: fmt.Errorf("%v", `net/http: invalid method "bad method"`), method: "bad method", URL: page},
 			{ok: false, err: fmt.Errorf("%v", `Get "http://127.0.0.1:808/": dial tcp 127.0.0.1:808: connect: connection refused`), method: method, URL: "http://127.0.0.1:808/"},
 			{ok: true, err: nil, method: method, URL: page},
-			{ok: true, err: nil, method: method, URL: "/biccies.txt", exp: "404 page not found\n"},
 			{ok: true, err: fmt.Errorf("%v", `net/http: invalid method "bad method"`), method: "bad method", URL: page},
 		}
 
@@ -75,6 +76,16 @@ func TestGetHTTP(t *testing.T) {
 
 			So(string(act), ShouldEqual, tt.exp)
 		}
+
+		Convey("Testing GetHTTP() with a missing page", func() {
+			URL := h.NewHTTPServer().String() + "/biccies.txt"
+			o := download(&source{Env: &Env{Log: newLog(), Method: method}, url: URL})
+			So(o.err, ShouldResemble, fmt.Errorf("unexpected HTTP status %q for %s", "404 Not Found", URL))
+
+			act, err := io.ReadAll(o.r)
+			So(err, ShouldBeNil)
+			So(string(act), ShouldBeEmpty)
+		})
 	})
 }
 
@@ -110,6 +121,165 @@ func TestMyHandler(t *testing.T) {
 	})
 }
 
+func TestSetHeaders(t *testing.T) {
+	Convey("Testing setHeaders()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		token := dir + "/token"
+		So(ioutil.WriteFile(token, []byte("s3cr3t\n"), 0o600), ShouldBeNil)
+
+		h := new(HTTPserver)
+		URL := h.NewHTTPServer().String()
+		h.Mux.HandleFunc("/headers.txt",
+			func(w http.ResponseWriter, r *http.Request) {
+				user, pass, _ := r.BasicAuth()
+				fmt.Fprintf(w, "%s|%s|%s|%s|%s", r.UserAgent(), r.Header.Get("X-Api-Key"), user, pass, r.Header.Get("Authorization"))
+			},
+		)
+		defer h.Server.Close()
+
+		tests := []struct {
+			exp  string
+			name string
+			s    *source
+		}{
+			{
+				name: "default User-Agent",
+				s:    &source{Env: &Env{Log: newLog(), Method: "GET"}},
+				exp:  agent + "||||",
+			},
+			{
+				name: "global User-Agent",
+				s:    &source{Env: &Env{Agent: "blacklist/1.0", Log: newLog(), Method: "GET"}},
+				exp:  "blacklist/1.0||||",
+			},
+			{
+				name: "source User-Agent and header",
+				s: &source{
+					Env:     &Env{Agent: "blacklist/1.0", Log: newLog(), Method: "GET"},
+					agent:   "Mozilla/5.0",
+					headers: []string{"X-Api-Key: abc123"},
+				},
+				exp: "Mozilla/5.0|abc123|||",
+			},
+			{
+				name: "basic auth",
+				s:    &source{Env: &Env{Log: newLog(), Method: "GET"}, user: "jdoe", pass: "pa55"},
+				exp:  agent + "||jdoe|pa55|Basic amRvZTpwYTU1",
+			},
+			{
+				name: "bearer token file",
+				s:    &source{Env: &Env{Log: newLog(), Method: "GET"}, token: token},
+				exp:  agent + "||||Bearer s3cr3t",
+			},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				tt.s.url = URL + "/headers.txt"
+				o := download(tt.s)
+				So(o.err, ShouldBeNil)
+
+				act, err := io.ReadAll(o.r)
+				So(err, ShouldBeNil)
+				So(string(act), ShouldEqual, tt.exp)
+			})
+		}
+
+		Convey("with a malformed header", func() {
+			o := download(&source{Env: &Env{Log: newLog(), Method: "GET"}, headers: []string{"broken"}, name: "bad", url: URL + "/headers.txt"})
+			So(o.err.Error(), ShouldEqual, `invalid header "broken" for source bad, expected "Name: value"`)
+		})
+
+		Convey("with a missing bearer token file", func() {
+			o := download(&source{Env: &Env{Log: newLog(), Method: "GET"}, name: "bad", token: dir + "/missing", url: URL + "/headers.txt"})
+			So(o.err.Error(), ShouldEqual, "unable to read bearer token file for source bad: open "+dir+"/missing: no such file or directory")
+		})
+	})
+}
+
+func TestDownloadMirrors(t *testing.T) {
+	Convey("Testing download() with mirrors", t, func() {
+		h := new(HTTPserver)
+		URL := h.NewHTTPServer().String()
+		defer h.Server.Close()
+
+		for page, data := range map[string]string{"/a.txt": "a.example.com", "/b.txt": "b.example.com", "/empty.txt": ""} {
+			data := data
+			h.Mux.HandleFunc(page, func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, data) })
+		}
+
+		tests := []struct {
+			err     bool
+			exp     string
+			mirror  []string
+			mirrors map[string]string
+			mode    string
+			name    string
+			served  string
+			url     string
+		}{
+			{name: "primary url", url: URL + "/a.txt", mirror: []string{URL + "/b.txt"}, exp: "a.example.com", served: URL + "/a.txt", mirrors: map[string]string{}},
+			{name: "dead primary url", url: URL + "/dead.txt", mirror: []string{URL + "/b.txt"}, exp: "b.example.com", served: URL + "/b.txt", mirrors: map[string]string{"mirrored": URL + "/b.txt"}},
+			{name: "empty primary url", url: URL + "/empty.txt", mirror: []string{"http://127.0.0.1:808/", URL + "/a.txt"}, exp: "a.example.com", served: URL + "/a.txt", mirrors: map[string]string{"mirrored": URL + "/a.txt"}},
+			{name: "all mirrors dead", url: URL + "/dead.txt", mirror: []string{"http://127.0.0.1:808/"}, err: true, mirrors: map[string]string{}},
+			{name: "concatenated mirrors", url: URL + "/a.txt", mirror: []string{URL + "/dead.txt", URL + "/b.txt"}, mode: concat, exp: "a.example.com\nb.example.com", served: URL + "/a.txt, " + URL + "/b.txt", mirrors: map[string]string{"mirrored": URL + "/a.txt, " + URL + "/b.txt"}},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				env := &Env{
+					ctr:    ctr{RWMutex: &sync.RWMutex{}, stat: stat{domains: &stats{}}},
+					Log:    newLog(),
+					Method: "GET",
+				}
+				o := download(&source{
+					Env:        env,
+					mirror:     tt.mirror,
+					mirrorMode: tt.mode,
+					name:       "mirrored",
+					url:        tt.url,
+				})
+				So(o.err != nil, ShouldEqual, tt.err)
+				So(o.served, ShouldEqual, tt.served)
+
+				o.sum(domains, 0, 1, 1)
+				So((&Config{Env: env}).GetMirrorStats(), ShouldResemble, tt.mirrors)
+
+				act, err := io.ReadAll(o.r)
+				So(err, ShouldBeNil)
+				So(string(act), ShouldEqual, tt.exp)
+			})
+		}
+
+		Convey("with every location failing", func() {
+			h.Mux.HandleFunc("/denied.txt", func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "denied", http.StatusUnauthorized)
+			})
+
+			get := func(url string, mirror ...string) *source {
+				return download(&source{
+					Env:    &Env{ctr: ctr{RWMutex: &sync.RWMutex{}, stat: stat{}}, Log: newLog(), Method: "GET"},
+					mirror: mirror,
+					name:   "mirrored",
+					url:    url,
+				})
+			}
+
+			o := get(URL+"/denied.txt", URL+"/empty.txt")
+			So(o.err, ShouldNotBeNil)
+			So(o.err.Error(), ShouldEqual, fmt.Sprintf(
+				"%[1]s/denied.txt: unexpected HTTP status \"401 Unauthorized\" for %[1]s/denied.txt\n%[1]s/empty.txt: no data returned", URL,
+			))
+
+			o = get(URL+"/empty.txt", URL+"/empty.txt")
+			So(o.err, ShouldBeNil)
+		})
+	})
+}
+
 var (
 	HTTPDomainData = `
 // This bind zone is intended to be included in a running dns server for a local net
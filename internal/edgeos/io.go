@@ -2,11 +2,13 @@ package edgeos
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -129,9 +131,31 @@ func (c *CFGstatic) read() io.Reader {
 	return strings.NewReader(c.Cfg)
 }
 
-// writeFile saves domains/hosts/roots data to disk
+// sameContent reports whether file exists and holds exactly data
+func sameContent(file string, data []byte) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	if fi, err := f.Stat(); err != nil || fi.Size() != int64(len(data)) {
+		return false
+	}
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return false
+	}
+	sum := sha256.Sum256(data)
+	return bytes.Equal(h.Sum(nil), sum[:])
+}
+
+// writeFile saves domains/hosts/roots data to disk, leaving the file on disk alone if its content
+// is unchanged; a staged file is then hard linked to the live file it would replace
 func (b *bList) writeFile() error {
 	var (
+		buf bytes.Buffer
 		err error
 		w   *os.File
 	)
@@ -140,11 +164,40 @@ func (b *bList) writeFile() error {
 		return nil
 	}
 
+	if b.data != nil {
+		if err = os.MkdirAll(filepath.Dir(b.data.file), 0o755); err != nil {
+			return err
+		}
+		if err = b.data.writeFile(); err != nil {
+			return err
+		}
+	}
+
+	if _, err = buf.ReadFrom(b.r); err != nil {
+		return err
+	}
+
+	live := liveName(b.file)
+	if live != b.file {
+		// never truncate a staged link to the live file
+		if err = os.Remove(b.file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if sameContent(live, buf.Bytes()) && (live == b.file || os.Link(live, b.file) == nil) {
+		return nil
+	}
+
 	if w, err = os.Create(b.file); err != nil {
 		return err
 	}
 
-	if _, err = io.Copy(w, b.r); err != nil {
+	if _, err = buf.WriteTo(w); err != nil {
+		return err
+	}
+
+	if err = w.Sync(); err != nil {
 		return err
 	}
 
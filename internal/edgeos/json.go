@@ -96,9 +96,25 @@ func getJSONsrcArray(c *cfgJSON) string {
 		js = fmt.Sprintf("%s%s%q: %q,\n", js, tabs(ȹ), disabled, booltoStr(o.disabled))
 		js = is(ȹ, js, "description", o.desc)
 		js = is(ȹ, js, "ip", o.ip)
+		js = is(ȹ, js, "ipv6", o.ip6)
+		js = is(ȹ, js, blockMode, o.mode)
+		js = is(ȹ, js, outputs, o.output)
+		js = is(ȹ, js, ipsets, o.ipset)
+		js = is(ȹ, js, nftsets, o.nftset)
 		js = is(ȹ, js, "prefix", o.prefix)
 		js = is(ȹ, js, files, o.file)
 		js = is(ȹ, js, urls, o.url)
+		if len(o.mirror) > 0 {
+			js += getJSONArray(&cfgJSON{array: o.mirror, leaf: mirrors, indent: ȹ})
+		}
+		js = is(ȹ, js, mirMode, o.mirrorMode)
+		js = is(ȹ, js, uagent, o.agent)
+		js = is(ȹ, js, username, o.user)
+		js = is(ȹ, js, bearer, o.token)
+		js = is(ȹ, js, caFile, o.tls.ca)
+		js = is(ȹ, js, insecure, o.tls.insecure)
+		js = is(ȹ, js, spkiPin, o.tls.pin)
+		js = is(ȹ, js, tlsMin, o.tls.minVer)
 		ȹ--
 		js = fmt.Sprintf("%s%s}%s%s", js, tabs(ȹ), ø, enter)
 	}
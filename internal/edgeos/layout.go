@@ -0,0 +1,296 @@
+package edgeos
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	layouts      = "output-layout"
+	perSource    = "per-source"
+	shardFmt     = "shard-%03d"
+	shardSize    = "shard-size"
+	shardDefault = 10000
+	sharded      = "sharded"
+	single       = "single"
+)
+
+// Merging returns true if sources are merged into one or more files per node, so the files don't name them
+func (e *Env) Merging() bool {
+	return e.Layout == single || e.Layout == sharded
+}
+
+// fileArea returns the node area a source's entries are written to
+func (s *source) fileArea() string {
+	switch s.nType {
+	case domn, excDomn, preDomn:
+		return domains
+	case excRoot, preRoot, root:
+		return roots
+	}
+	return hosts
+}
+
+// layoutFile returns the path of a merged or sharded file for an area
+func (e *Env) layoutFile(area, name string) string {
+	return fmt.Sprintf(e.FnFmt, e.Dir, area, name, e.Ext)
+}
+
+// shards returns the existing shard files for an area
+func (e *Env) shards(area string) []string {
+	f, _ := filepath.Glob(e.layoutFile(area, "shard-*"))
+	return f
+}
+
+// layoutFiles returns the merged or sharded files for every area with sources
+func (o *Objects) layoutFiles() []string {
+	var (
+		names []string
+		seen  = make(map[string]bool)
+	)
+
+	for _, s := range o.src {
+		area := s.fileArea()
+		if seen[area] {
+			continue
+		}
+		seen[area] = true
+
+		switch o.Layout {
+		case single:
+			names = append(names, o.layoutFile(area, all))
+		default:
+			names = append(names, o.shards(area)...)
+		}
+	}
+	return names
+}
+
+// setLayout validates the output-layout and shard-size settings and applies them to the Env
+func (c *Config) setLayout() error {
+	if !c.tree.keyExists(rootNode) {
+		return nil
+	}
+
+	r := c.tree[rootNode]
+	switch r.layout {
+	case "":
+	case perSource, single, sharded:
+		c.Layout = r.layout
+	default:
+		return fmt.Errorf("invalid %s %q, must be one of %s, %s or %s", layouts, r.layout, perSource, single, sharded)
+	}
+
+	if r.shards != "" {
+		n, err := strconv.Atoi(r.shards)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid %s %q, must be a positive number of lines", shardSize, r.shards)
+		}
+		c.ShardSize = n
+	}
+
+	if !c.Merging() {
+		return nil
+	}
+
+	for _, node := range []string{rootNode, domains, hosts} {
+		if !c.tree.keyExists(node) {
+			continue
+		}
+
+		for _, s := range append([]*source{c.tree[node]}, c.tree[node].src...) {
+			out := s.output
+			if out == "" {
+				out = c.tree.getOutput(node)
+			}
+
+			switch out {
+			case "", dnsmasqOut, hostsFileOut:
+			default:
+				return fmt.Errorf("%s %s for %s needs dnsmasq or hosts-file output", layouts, c.Layout, s.name)
+			}
+		}
+	}
+	return nil
+}
+
+// merge adds a processed source's lines to its node's merged file and writes any companion data file
+func (c *Config) merge(s *source, b *bList) error {
+	if b.size == 0 {
+		return nil
+	}
+
+	if b.data != nil {
+		if err := os.MkdirAll(filepath.Dir(b.data.file), 0o755); err != nil {
+			return err
+		}
+		if err := b.data.writeFile(); err != nil {
+			return err
+		}
+	}
+
+	if c.merged == nil {
+		c.merged = make(map[string][]string)
+	}
+
+	area := s.fileArea()
+	scan := bufio.NewScanner(b.r)
+	for scan.Scan() {
+		if line := scan.Text(); line != "" {
+			c.merged[area] = append(c.merged[area], line)
+		}
+	}
+	return scan.Err()
+}
+
+// mergeContent processes each Contenter's sources in name order, so entries found in more than one source
+// are always kept by the same source; WriteLayout merges them into their node's lines
+func (c *Config) mergeContent(cts ...Contenter) error {
+	var errs []string
+
+	for _, ct := range cts {
+		srcs := append([]*source{}, ct.GetList().src...)
+		sort.SliceStable(srcs, func(i, j int) bool { return srcs[i].name < srcs[j].name })
+		c.done = append(c.done, srcs...)
+
+		for _, s := range srcs {
+			if s.err != nil {
+				errs = append(errs, s.err.Error())
+			}
+
+			s.ctr.Lock()
+			s.ctr.stat[typeInt(s.nType)] = &stats{}
+			s.ctr.Unlock()
+
+			s.process()
+		}
+	}
+
+	if errs != nil {
+		return &SourceError{Errs: errs}
+	}
+	return nil
+}
+
+// writeSources writes the file of each processed source in the per-source layout, releasing its entries
+// as soon as they're on disk
+func (c *Config) writeSources() error {
+	var errs []string
+
+	if c.OutDir != "" {
+		if err := os.MkdirAll(c.OutDir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range c.done {
+		if s.kept == nil {
+			continue
+		}
+
+		area := typeInt(s.nType)
+		write := s.newBList(area, s.kept, len(s.kept.entry)).writeFile
+		if s.err != nil {
+			write = func() error { return s.keepLive(area) }
+		}
+		if err := write(); err != nil {
+			errs = append(errs, err.Error())
+		}
+		s.release()
+	}
+
+	if errs != nil {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// WriteLayout writes each processed source's file in the per-source layout, otherwise the merged lines of
+// every node as a single sorted, deduplicated file, or as shards of at most shard-size lines, removing shards
+// left over from earlier runs
+func (c *Config) WriteLayout() error {
+	if !c.Merging() {
+		return c.writeSources()
+	}
+
+	size := c.ShardSize
+	if size < 1 {
+		size = shardDefault
+	}
+
+	for _, s := range c.done {
+		if s.kept == nil {
+			continue
+		}
+		if s.err != nil {
+			s.Log.Warningf("%s: left out of the %s layout until it can be fetched", s.name, c.Layout)
+		}
+		if err := c.merge(s, s.newBList(typeInt(s.nType), s.kept, len(s.kept.entry))); err != nil {
+			return err
+		}
+		s.release()
+	}
+
+	areas := make([]string, 0, len(c.merged))
+	for area := range c.merged {
+		areas = append(areas, area)
+	}
+	sort.Strings(areas)
+
+	for _, area := range areas {
+		lines := dedupe(c.merged[area])
+
+		if c.Layout == single {
+			b := &bList{file: c.layoutFile(area, all), r: strings.NewReader(strings.Join(lines, "\n") + "\n"), size: len(lines)}
+			if err := b.writeFile(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var written []string
+		for i := 0; i < len(lines); i += size {
+			end := i + size
+			if end > len(lines) {
+				end = len(lines)
+			}
+
+			b := &bList{
+				file: c.layoutFile(area, fmt.Sprintf(shardFmt, i/size+1)),
+				r:    strings.NewReader(strings.Join(lines[i:end], "\n") + "\n"),
+				size: end - i,
+			}
+			if err := b.writeFile(); err != nil {
+				return err
+			}
+			written = append(written, b.file)
+		}
+
+		if err := purgeFiles(diffArray(written, c.shards(area))); err != nil {
+			return err
+		}
+	}
+
+	c.merged = nil
+	return nil
+}
+
+// dedupe returns a sorted copy of lines without duplicates
+func dedupe(lines []string) []string {
+	l := append([]string{}, lines...)
+	sort.Strings(l)
+
+	var u []string
+	for i, line := range l {
+		if i == 0 || line != l[i-1] {
+			u = append(u, line)
+		}
+	}
+	return u
+}
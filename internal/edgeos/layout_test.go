@@ -0,0 +1,125 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLayout(t *testing.T) {
+	Convey("Testing output layouts", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		for name, data := range map[string]string{
+			"ads":   "ads.example.com\nshared.example.com\n",
+			"track": "shared.example.com\ntrack.example.com\n",
+		} {
+			So(ioutil.WriteFile(filepath.Join(dir, name+".txt"), []byte(data), 0o644), ShouldBeNil)
+		}
+
+		newCfg := func(layout string) (*Config, error) {
+			cfg := fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+    %s
+    domains {
+        source ads {
+            file %[2]s/ads.txt
+        }
+        source track {
+            file %[2]s/track.txt
+        }
+    }
+}`, layout, dir)
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+				WCard(Wildcard{Node: "*s", Name: "*"}),
+			)
+			return c, c.Blacklist(&CFGstatic{Cfg: cfg})
+		}
+
+		process := func(c *Config) {
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			So(c.WriteLayout(), ShouldBeNil)
+		}
+
+		read := func(f string) string {
+			b, err := ioutil.ReadFile(filepath.Join(dir, f))
+			So(err, ShouldBeNil)
+			return string(b)
+		}
+
+		Convey("with the per-source layout", func() {
+			c, err := newCfg("output-layout per-source")
+			So(err, ShouldBeNil)
+			process(c)
+
+			So(read("domains.ads.blacklist.conf")+read("domains.track.blacklist.conf"), ShouldContainSubstring, "address=/track.example.com/0.0.0.0\n")
+			_, err = os.Stat(filepath.Join(dir, "domains.all.blacklist.conf"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("with the single layout", func() {
+			c, err := newCfg("output-layout single")
+			So(err, ShouldBeNil)
+			process(c)
+
+			So(read("domains.all.blacklist.conf"), ShouldEqual, "address=/ads.example.com/0.0.0.0\naddress=/shared.example.com/0.0.0.0\naddress=/track.example.com/0.0.0.0\n")
+			So(c.GetAll().Files().Strings(), ShouldResemble, []string{dir + "/domains.all.blacklist.conf", dir + "/roots.all.blacklist.conf"})
+
+			_, err = os.Stat(filepath.Join(dir, "domains.ads.blacklist.conf"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("with the sharded layout", func() {
+			c, err := newCfg("output-layout sharded\n    shard-size 2")
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, "domains.shard-009.blacklist.conf"), []byte("stale\n"), 0o644), ShouldBeNil)
+			process(c)
+
+			So(read("domains.shard-001.blacklist.conf"), ShouldEqual, "address=/ads.example.com/0.0.0.0\naddress=/shared.example.com/0.0.0.0\n")
+			So(read("domains.shard-002.blacklist.conf"), ShouldEqual, "address=/track.example.com/0.0.0.0\n")
+			So(c.GetAll().Files().Strings(), ShouldResemble, []string{dir + "/domains.shard-001.blacklist.conf", dir + "/domains.shard-002.blacklist.conf"})
+
+			_, err = os.Stat(filepath.Join(dir, "domains.shard-009.blacklist.conf"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			Convey("and stale per-source files removed", func() {
+				So(ioutil.WriteFile(filepath.Join(dir, "domains.ads.blacklist.conf"), []byte("stale\n"), 0o644), ShouldBeNil)
+				So(c.GetAll().Files().Remove(), ShouldBeNil)
+
+				_, err = os.Stat(filepath.Join(dir, "domains.ads.blacklist.conf"))
+				So(os.IsNotExist(err), ShouldBeTrue)
+				So(read("domains.shard-001.blacklist.conf"), ShouldNotBeEmpty)
+			})
+		})
+
+		Convey("with invalid settings", func() {
+			tests := []struct {
+				err    string
+				layout string
+			}{
+				{layout: "output-layout tree", err: `invalid output-layout "tree", must be one of per-source, single or sharded`},
+				{layout: "output-layout sharded\n    shard-size 0", err: `invalid shard-size "0", must be a positive number of lines`},
+				{layout: "output-layout single\n    output unbound", err: `output-layout single for blacklist needs dnsmasq or hosts-file output`},
+			}
+
+			for _, tt := range tests {
+				_, err := newCfg(tt.layout)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, tt.err)
+			}
+		})
+	})
+}
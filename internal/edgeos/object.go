@@ -21,9 +21,14 @@ func (o *Objects) addObj(c *Config, node string) {
 // Files returns a list of dnsmasq conf files from all srcs
 func (o *Objects) Files() *CFile {
 	c := CFile{Env: o.Env}
-	if !o.Disabled {
+	switch {
+	case o.Disabled:
+	case o.Merging():
+		c.Names = o.layoutFiles()
+		sort.Strings(c.Names)
+	default:
 		for _, obj := range o.src {
-			c.Names = append(c.Names, obj.setFilePrefix(o.Env.Dir+"/%v.%v."+o.Env.Ext))
+			c.Names = append(c.Names, obj.setFilePrefix(o.Env.outputDir(obj.output)+"/%v.%v."+o.Env.Ext))
 		}
 		sort.Strings(c.Names)
 	}
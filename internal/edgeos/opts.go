@@ -13,27 +13,47 @@ import (
 // Env is struct of parameters
 type Env struct {
 	ctr
+	live []string // live Dir, DataDir and OutDir while they're staged for an update
 	// ioWriter io.Writer
-	Log      *logging.Logger
-	API      string        `json:"API,omitempty"`
-	Arch     string        `json:"Arch,omitempty"`
-	Bash     string        `json:"Bash,omitempty"`
-	Cores    int           `json:"Cores,omitempty"`
-	Disabled bool          `json:"Disabled"`
-	Dbug     bool          `json:"Dbug,omitempty"`
-	Dex      *list         `json:"Dex,omitempty"`
-	Dir      string        `json:"Dir,omitempty"`
-	DNSsvc   string        `json:"dnsmasq service,omitempty"`
-	Exc      *list         `json:"Exc,omitempty"`
-	Ext      string        `json:"dnsmasq fileExt.,omitempty"`
-	File     string        `json:"File,omitempty"`
-	FnFmt    string        `json:"File name fmt,omitempty"`
-	InCLI    string        `json:"-"`
-	Method   string        `json:"HTTP method,omitempty"`
-	Pfx      dnsPfx        `json:"Prefix,omitempty"`
-	Test     bool          `json:"Test,omitempty"`
-	Timeout  time.Duration `json:"Timeout,omitempty"`
-	Verb     bool          `json:"Verbosity,omitempty"`
+	Log       *logging.Logger
+	API       string        `json:"API,omitempty"`
+	Agent     string        `json:"User agent,omitempty"`
+	Arch      string        `json:"Arch,omitempty"`
+	Bash      string        `json:"Bash,omitempty"`
+	CacheAge  time.Duration `json:"Cache max age,omitempty"`
+	CacheDir  string        `json:"Cache dir,omitempty"`
+	Cores     int           `json:"Cores,omitempty"`
+	DataDir   string        `json:"Data dir,omitempty"`
+	Disabled  bool          `json:"Disabled"`
+	Dbug      bool          `json:"Dbug,omitempty"`
+	Dex       *list         `json:"Dex,omitempty"`
+	Dir       string        `json:"Dir,omitempty"`
+	DNSsvc    string        `json:"dnsmasq service,omitempty"`
+	DNStest   string        `json:"dnsmasq test,omitempty"`
+	DNSver    string        `json:"dnsmasq version,omitempty"`
+	Exc       *list         `json:"Exc,omitempty"`
+	Ext       string        `json:"dnsmasq fileExt.,omitempty"`
+	File      string        `json:"File,omitempty"`
+	FnFmt     string        `json:"File name fmt,omitempty"`
+	Force     bool          `json:"Force,omitempty"`
+	GenDir    string        `json:"Generations dir,omitempty"`
+	GenKeep   int           `json:"Generations kept,omitempty"`
+	InCLI     string        `json:"-"`
+	Layout    string        `json:"Output layout,omitempty"`
+	Method    string        `json:"HTTP method,omitempty"`
+	Offline   bool          `json:"Offline,omitempty"`
+	OutDir    string        `json:"Output dir,omitempty"`
+	Pfx       dnsPfx        `json:"Prefix,omitempty"`
+	PidFile   string        `json:"dnsmasq pid file,omitempty"`
+	Reload    string        `json:"Reload strategy,omitempty"`
+	ReloadCmd string        `json:"Reload command,omitempty"`
+	ShardSize int           `json:"Shard size,omitempty"`
+	Target    string        `json:"Target,omitempty"`
+	Test      bool          `json:"Test,omitempty"`
+	Timeout   time.Duration `json:"Timeout,omitempty"`
+	Verb      bool          `json:"Verbosity,omitempty"`
+	Verify    int           `json:"Verify samples,omitempty"`
+	VerifySvr string        `json:"Verify server,omitempty"`
 	Wildcard/*..........*/ `json:"Wildcard,omitempty"`
 }
 
@@ -102,6 +122,24 @@ func Bash(s string) Option {
 	}
 }
 
+// CacheAge sets the maximum age of a last-known-good source copy
+func CacheAge(d time.Duration) Option {
+	return func(c *Config) Option {
+		previous := c.CacheAge
+		c.CacheAge = d
+		return CacheAge(previous)
+	}
+}
+
+// CacheDir sets the last-known-good source cache directory
+func CacheDir(s string) Option {
+	return func(c *Config) Option {
+		previous := c.CacheDir
+		c.CacheDir = s
+		return CacheDir(previous)
+	}
+}
+
 // Cores sets max CPU cores
 func Cores(i int) Option {
 	return func(c *Config) Option {
@@ -121,6 +159,15 @@ func Disabled(b bool) Option {
 	}
 }
 
+// DataDir sets the directory for data files that dnsmasq loads from outside its conf-dir
+func DataDir(s string) Option {
+	return func(c *Config) Option {
+		previous := c.DataDir
+		c.DataDir = s
+		return DataDir(previous)
+	}
+}
+
 // Dbug toggles Debug level on or off
 func Dbug(b bool) Option {
 	return func(c *Config) Option {
@@ -148,6 +195,24 @@ func DNSsvc(s string) Option {
 	}
 }
 
+// DNStest sets the command that checks the generated files before dnsmasq is reloaded
+func DNStest(s string) Option {
+	return func(c *Config) Option {
+		previous := c.DNStest
+		c.DNStest = s
+		return DNStest(previous)
+	}
+}
+
+// DNSver sets the command that reports the dnsmasq version and compile time options
+func DNSver(s string) Option {
+	return func(c *Config) Option {
+		previous := c.DNSver
+		c.DNSver = s
+		return DNSver(previous)
+	}
+}
+
 // Ext sets the blacklist file n extension
 func Ext(s string) Option {
 	return func(c *Config) Option {
@@ -175,6 +240,33 @@ func FileNameFmt(s string) Option {
 	}
 }
 
+// Force reloads dnsmasq even if no blacklist file changed
+func Force(b bool) Option {
+	return func(c *Config) Option {
+		previous := c.Force
+		c.Force = b
+		return Force(previous)
+	}
+}
+
+// GenDir sets the directory that generations of blacklist files are saved in
+func GenDir(s string) Option {
+	return func(c *Config) Option {
+		previous := c.GenDir
+		c.GenDir = s
+		return GenDir(previous)
+	}
+}
+
+// GenKeep sets how many generations of blacklist files are kept
+func GenKeep(i int) Option {
+	return func(c *Config) Option {
+		previous := c.GenKeep
+		c.GenKeep = i
+		return GenKeep(previous)
+	}
+}
+
 // InCLI sets the CLI inSession command
 func InCLI(s string) Option {
 	return func(c *Config) Option {
@@ -184,6 +276,15 @@ func InCLI(s string) Option {
 	}
 }
 
+// Layout sets the output file layout: per-source, single or sharded
+func Layout(s string) Option {
+	return func(c *Config) Option {
+		previous := c.Layout
+		c.Layout = s
+		return Layout(previous)
+	}
+}
+
 // Logger sets a pointer to the logger
 func Logger(l *logging.Logger) Option {
 	return func(c *Config) Option {
@@ -218,6 +319,33 @@ func NewConfig(opts ...Option) *Config {
 	return &c
 }
 
+// Offline toggles rebuilding URL sources from the last-known-good cache instead of downloading them
+func Offline(b bool) Option {
+	return func(c *Config) Option {
+		previous := c.Offline
+		c.Offline = b
+		return Offline(previous)
+	}
+}
+
+// OutDir sets the directory Unbound and RPZ output is written to, outside dnsmasq's conf-dir
+func OutDir(s string) Option {
+	return func(c *Config) Option {
+		previous := c.OutDir
+		c.OutDir = s
+		return OutDir(previous)
+	}
+}
+
+// PidFile sets the file dnsmasq writes its PID to, used by the signal reload strategy
+func PidFile(s string) Option {
+	return func(c *Config) Option {
+		previous := c.PidFile
+		c.PidFile = s
+		return PidFile(previous)
+	}
+}
+
 // Prefix sets the dnsmasq configuration address line prefix
 func Prefix(d string, h string) Option {
 	return func(c *Config) Option {
@@ -226,6 +354,33 @@ func Prefix(d string, h string) Option {
 	}
 }
 
+// Reload sets how dnsmasq is reloaded: restart, signal or custom
+func Reload(s string) Option {
+	return func(c *Config) Option {
+		previous := c.Reload
+		c.Reload = s
+		return Reload(previous)
+	}
+}
+
+// ReloadCmd sets the command run by the custom reload strategy
+func ReloadCmd(s string) Option {
+	return func(c *Config) Option {
+		previous := c.ReloadCmd
+		c.ReloadCmd = s
+		return ReloadCmd(previous)
+	}
+}
+
+// ShardSize sets the maximum number of lines written to each file of the sharded layout
+func ShardSize(i int) Option {
+	return func(c *Config) Option {
+		previous := c.ShardSize
+		c.ShardSize = i
+		return ShardSize(previous)
+	}
+}
+
 // Env Stringer interface
 func (e *Env) String() string {
 	out, err := json.MarshalIndent(e, "", "\t")
@@ -253,6 +408,15 @@ func Timeout(t time.Duration) Option {
 	}
 }
 
+// UserAgent sets the default HTTP User-Agent for source downloads
+func UserAgent(s string) Option {
+	return func(c *Config) Option {
+		previous := c.Agent
+		c.Agent = s
+		return UserAgent(previous)
+	}
+}
+
 // Verb sets the verbosity level to v
 func Verb(b bool) Option {
 	return func(c *Config) Option {
@@ -262,6 +426,24 @@ func Verb(b bool) Option {
 	}
 }
 
+// Verify sets how many blocked and excluded entries are checked against the resolver after an update
+func Verify(i int) Option {
+	return func(c *Config) Option {
+		previous := c.Verify
+		c.Verify = i
+		return Verify(previous)
+	}
+}
+
+// VerifyServer sets the DNS server, host:port, that Verify queries
+func VerifyServer(s string) Option {
+	return func(c *Config) Option {
+		previous := c.VerifySvr
+		c.VerifySvr = s
+		return VerifyServer(previous)
+	}
+}
+
 // WCard sets file globbing wildcard values
 func WCard(w Wildcard) Option {
 	return func(c *Config) Option {
@@ -0,0 +1,261 @@
+package edgeos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// ProbeAbort aborts the blacklist update when the connectivity probe fails
+	ProbeAbort = "abort"
+	// ProbeCache rebuilds the blacklists from the last-known-good cache when the connectivity probe fails
+	ProbeCache = "cache"
+	// ProbeContinue carries on downloading when the connectivity probe fails
+	ProbeContinue = "continue"
+
+	probeFail    = "probe-failure"
+	probeMethod  = "probe-method"
+	probeNetwork = "probe-network"
+	probeSources = "sources"
+	probeTarget  = "probe-target"
+	probeTimeout = 3 * time.Second
+)
+
+// probeOpts holds the connectivity probe settings
+type probeOpts struct {
+	failure string
+	method  string
+	network string
+	targets []string
+}
+
+// endpoint is a single connectivity probe target
+type endpoint struct {
+	addr string
+	src  *source
+	url  string
+}
+
+// defaults fills in unset probe settings
+func (p probeOpts) defaults() probeOpts {
+	if p.failure == "" {
+		p.failure = ProbeCache
+	}
+	if p.method == "" {
+		p.method = "tcp"
+	}
+	if p.network == "" {
+		p.network = "tcp"
+	}
+	if len(p.targets) < 1 {
+		p.targets = []string{probeSources}
+	}
+	return p
+}
+
+// set assigns a probe setting from a configuration leaf
+func (p *probeOpts) set(k, v string) {
+	switch k {
+	case probeFail:
+		p.failure = v
+	case probeMethod:
+		p.method = v
+	case probeNetwork:
+		p.network = v
+	case probeTarget:
+		p.targets = append(p.targets, v)
+	}
+}
+
+// validate returns an error if a probe setting is invalid
+func (p probeOpts) validate() error {
+	switch p.failure {
+	case ProbeAbort, ProbeCache, ProbeContinue:
+	default:
+		return fmt.Errorf("invalid %s %q, must be one of %s, %s or %s", probeFail, p.failure, ProbeAbort, ProbeCache, ProbeContinue)
+	}
+
+	switch p.method {
+	case "http", "tcp":
+	default:
+		return fmt.Errorf("invalid %s %q, must be either http or tcp", probeMethod, p.method)
+	}
+
+	switch p.network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return fmt.Errorf("invalid %s %q, must be one of tcp, tcp4 or tcp6", probeNetwork, p.network)
+	}
+	return nil
+}
+
+// newEndpoint converts a probe-target, either host:port or a URL, into an endpoint
+func newEndpoint(target string) (endpoint, error) {
+	if !strings.Contains(target, "://") {
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			return endpoint{}, fmt.Errorf("invalid %s %q: %v", probeTarget, target, err)
+		}
+
+		u := &url.URL{Scheme: "http", Host: target}
+		if port == "443" {
+			u = &url.URL{Scheme: "https", Host: host}
+		}
+		return endpoint{addr: target, url: u.String() + "/"}, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Hostname() == "" {
+		return endpoint{}, fmt.Errorf("invalid %s %q", probeTarget, target)
+	}
+	return endpoint{addr: hostPort(u), url: target}, nil
+}
+
+// hostPort returns the host:port dialled for an http:// or https:// URL
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	switch {
+	case port != "":
+	case strings.EqualFold(u.Scheme, "https"):
+		port = "443"
+	default:
+		port = "80"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// getProbe returns the connectivity probe settings with defaults applied
+func (c tree) getProbe() probeOpts {
+	if c.keyExists(rootNode) {
+		return c[rootNode].probe.defaults()
+	}
+	return probeOpts{}.defaults()
+}
+
+// netEndpoints returns an endpoint for each distinct http:// or https:// host used by the URL sources
+func (c tree) netEndpoints(env *Env) []endpoint {
+	var (
+		eps  []endpoint
+		seen = make(map[string]bool)
+	)
+
+	for _, node := range []string{domains, hosts} {
+		for _, s := range c.validate(node).Filter(urls).src {
+			s.Env = env
+			for _, loc := range s.locations() {
+				u, err := url.Parse(loc)
+				if err != nil || u.Hostname() == "" {
+					continue
+				}
+
+				switch strings.ToLower(u.Scheme) {
+				case "", "http", "https":
+				default:
+					continue
+				}
+
+				if addr := hostPort(u); !seen[addr] {
+					seen[addr] = true
+					eps = append(eps, endpoint{addr: addr, src: s, url: loc})
+				}
+			}
+		}
+	}
+	return eps
+}
+
+// ProbeFailure returns the policy to apply when the connectivity probe fails
+func (c *Config) ProbeFailure() string {
+	return c.tree.getProbe().failure
+}
+
+// Probe returns nil if any probe target is reachable or no URL sources need the network
+func (c *Config) Probe() error {
+	p := c.tree.getProbe()
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	r := c.tree.getResolver()
+	if err := r.validate(); err != nil {
+		return err
+	}
+
+	srcs := c.tree.netEndpoints(c.Env)
+	if len(srcs) < 1 {
+		c.Debug("No URL sources need network access, skipping connectivity probe")
+		return nil
+	}
+
+	var eps []endpoint
+	for _, t := range p.targets {
+		if t == probeSources {
+			eps = append(eps, srcs...)
+			continue
+		}
+
+		ep, err := newEndpoint(t)
+		if err != nil {
+			return err
+		}
+		eps = append(eps, ep)
+	}
+
+	err := errors.New("no probe targets")
+	for _, ep := range eps {
+		if err = p.probe(ep, r); err == nil {
+			return nil
+		}
+		c.Debug(fmt.Sprintf("Connectivity probe of %s failed: %v", ep.addr, err))
+	}
+	return fmt.Errorf("no internet access, connectivity probe failed: %v", err)
+}
+
+// probe checks whether ep is reachable using the configured method, network and bootstrap resolvers
+func (p probeOpts) probe(ep endpoint, r resolverOpts) error {
+	dial := r.dialContext(&net.Dialer{Timeout: probeTimeout}, p.network)
+
+	if p.method == "tcp" {
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		defer cancel()
+
+		conn, err := dial(ctx, p.network, ep.addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	client := &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+	if ep.src != nil {
+		var err error
+		if client, err = ep.src.client(); err != nil {
+			return err
+		}
+	}
+
+	client.Timeout = probeTimeout
+	client.Transport.(*http.Transport).DialContext = dial
+
+	req, err := http.NewRequest(http.MethodHead, ep.url, nil)
+	if err != nil {
+		return err
+	}
+	if ep.src != nil {
+		if err = ep.src.setHeaders(req); err != nil {
+			return err
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,95 @@
+package edgeos
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProbe(t *testing.T) {
+	Convey("Testing the connectivity probe", t, func() {
+		srv := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "probed.example.com")
+			},
+		))
+		defer srv.Close()
+
+		load := func(probe, url string) *Config {
+			cfg := fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+%s
+    domains {
+        source probed {
+            %s
+        }
+    }
+}`, probe, url)
+			c := NewConfig(Logger(newLog()))
+			So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+			return c
+		}
+
+		tests := []struct {
+			err    string
+			name   string
+			policy string
+			probe  string
+			url    string
+		}{
+			{name: "defaults", policy: ProbeCache},
+			{name: "an http probe of the sources", probe: "probe-method http", policy: ProbeCache},
+			{name: "an IPv4 tcp probe", probe: "probe-network tcp4\n    probe-failure abort", policy: ProbeAbort},
+			{name: "an unreachable target", probe: "probe-target 127.0.0.1:1\n    probe-failure continue", policy: ProbeContinue, err: "no internet access, connectivity probe failed"},
+			{name: "an unreachable target then the sources", probe: "probe-target 127.0.0.1:1\n    probe-target sources", policy: ProbeCache},
+			{name: "a url target", probe: "probe-target " + srv.URL + "/\n    probe-method http", policy: ProbeCache},
+			{name: "an invalid target", probe: "probe-target example.com", policy: ProbeCache, err: `invalid probe-target "example.com"`},
+			{name: "an invalid method", probe: "probe-method ping", policy: ProbeCache, err: `invalid probe-method "ping", must be either http or tcp`},
+			{name: "an invalid network", probe: "probe-network udp", policy: ProbeCache, err: `invalid probe-network "udp", must be one of tcp, tcp4 or tcp6`},
+			{name: "an invalid policy", probe: "probe-failure retry", policy: "retry", err: `invalid probe-failure "retry", must be one of abort, cache or continue`},
+			{name: "only file URL sources", probe: "probe-target 127.0.0.1:1", url: "url file:///tmp/domains.txt", policy: ProbeCache},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				url := tt.url
+				if url == "" {
+					url = "url " + srv.URL + "/domains.txt"
+				}
+
+				c := load(tt.probe, url)
+				So(c.ProbeFailure(), ShouldEqual, tt.policy)
+
+				err := c.Probe()
+				switch tt.err {
+				case "":
+					So(err, ShouldBeNil)
+				default:
+					So(err, ShouldNotBeNil)
+					So(strings.HasPrefix(err.Error(), tt.err), ShouldBeTrue)
+				}
+			})
+		}
+
+		Convey("with the probe settings shown in the configuration", func() {
+			c := load("probe-failure continue\n    probe-target 127.0.0.1:1\n    probe-target sources", "url "+srv.URL)
+			So(c.String(), ShouldContainSubstring, `"probe-failure": "continue",`)
+			So(c.String(), ShouldContainSubstring, `"probe-target": [`)
+		})
+
+		Convey("with probe settings ignored outside the root node", func() {
+			cfg := `blacklist {
+    domains {
+        probe-failure abort
+    }
+}`
+			c := NewConfig()
+			So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+			So(c.ProbeFailure(), ShouldEqual, ProbeCache)
+		})
+	})
+}
@@ -0,0 +1,103 @@
+package edgeos
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// blocksDomains returns true if a source's entries block every subdomain of each entry
+func (s *source) blocksDomains() bool {
+	switch s.nType {
+	case domn, preDomn, preRoot:
+		return true
+	}
+	return false
+}
+
+// isExclusion returns true if a source's entries are exclusions
+func (s *source) isExclusion() bool {
+	switch s.nType {
+	case excDomn, excHost, excRoot:
+		return true
+	}
+	return false
+}
+
+// action returns how a source's entries are answered, so entries are only pruned by parents answered the same way
+func (s *source) action() string {
+	return strings.Join([]string{s.output, s.mode, s.ip, s.ip6, s.ipset, s.nftset}, "|")
+}
+
+// covered returns true if an ancestor of fqdn, or fqdn itself when self is true, is blocked with the same action
+// and no exclusion lies in between
+func covered(parents map[string]string, excluded map[string]bool, fqdn, act string, self bool) bool {
+	if a, ok := parents[fqdn]; self && ok && a == act {
+		return true
+	}
+
+	for i := strings.IndexByte(fqdn, '.'); i > -1; i = strings.IndexByte(fqdn, '.') {
+		fqdn = fqdn[i+1:]
+		if excluded[fqdn] {
+			return false
+		}
+		if a, ok := parents[fqdn]; ok && a == act {
+			return true
+		}
+	}
+	return false
+}
+
+// Prune removes entries from every processed source that are already blocked by an ancestor domain
+// in a domain list with the same action and returns the number of entries pruned; it runs before WriteLayout,
+// so each file is written once
+func (c *Config) Prune() int {
+	var (
+		excluded = make(map[string]bool)
+		parents  = make(map[string]string)
+	)
+
+	for _, s := range c.done {
+		if s.kept == nil {
+			continue
+		}
+		for k := range s.kept.entry {
+			switch {
+			case s.isExclusion():
+				excluded[k] = true
+			case s.blocksDomains():
+				parents[k] = s.action()
+			}
+		}
+	}
+
+	var total int
+	for _, s := range c.done {
+		if s.kept == nil || s.isExclusion() {
+			continue
+		}
+
+		var pruned int
+		s.kept.Lock()
+		for k := range s.kept.entry {
+			if covered(parents, excluded, k, s.action(), !s.blocksDomains()) {
+				delete(s.kept.entry, k)
+				pruned++
+			}
+		}
+		s.kept.Unlock()
+
+		if pruned == 0 {
+			continue
+		}
+
+		total += pruned
+		s.Log.Infof("%s: pruned: %d", s.name, pruned)
+
+		area := typeInt(s.nType)
+		if ctr, ok := s.ctr.stat[area]; ok {
+			atomic.AddInt32(&ctr.dropped, int32(pruned))
+			atomic.AddInt32(&ctr.kept, -int32(pruned))
+		}
+	}
+	return total
+}
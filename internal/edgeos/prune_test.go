@@ -0,0 +1,98 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrune(t *testing.T) {
+	Convey("Testing Prune()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		for name, data := range map[string]string{
+			"child": "ads.example.com\nx.ads.example.com\nother.com\n",
+			"other": "y.example.com\n",
+		} {
+			So(ioutil.WriteFile(filepath.Join(dir, name+".txt"), []byte(data), 0o644), ShouldBeNil)
+		}
+
+		newCfg := func(layout string) *Config {
+			cfg := fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+    include example.net
+    %s
+    domains {
+        exclude good.example.com
+        include bad.good.example.com
+        include example.com
+        source child {
+            file %[2]s/child.txt
+        }
+        source other {
+            dns-redirect-ip 10.0.0.1
+            file %[2]s/other.txt
+        }
+    }
+    hosts {
+        include www.example.net
+    }
+}`, layout, dir)
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+
+			for _, iface := range []IFace{PreRObj, PreDObj, PreHObj, ExRtObj, ExDmObj, ExHtObj, FileObj} {
+				ct, err := c.NewContent(iface)
+				So(err, ShouldBeNil)
+				So(c.Process(ct), ShouldBeNil)
+			}
+			return c
+		}
+
+		read := func(f string) string {
+			b, err := ioutil.ReadFile(filepath.Join(dir, f))
+			So(err, ShouldBeNil)
+			return string(b)
+		}
+
+		Convey("with the per-source layout", func() {
+			c := newCfg("")
+			So(c.Prune(), ShouldEqual, 3)
+			So(c.WriteLayout(), ShouldBeNil)
+
+			So(read("domains.child.blacklist.conf"), ShouldEqual, "address=/other.com/0.0.0.0\n")
+			So(read("domains.other.blacklist.conf"), ShouldEqual, "address=/y.example.com/10.0.0.1\n")
+			So(read("domains.blacklisted-subdomains.blacklist.conf"), ShouldEqual, "address=/bad.good.example.com/0.0.0.0\naddress=/example.com/0.0.0.0\n")
+
+			_, err := os.Stat(filepath.Join(dir, "hosts.blacklisted-servers.blacklist.conf"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			for _, s := range c.done {
+				So(s.kept, ShouldBeNil)
+			}
+			So(c.Prune(), ShouldEqual, 0)
+		})
+
+		Convey("with the single layout", func() {
+			c := newCfg("output-layout single")
+			So(c.Prune(), ShouldEqual, 3)
+			So(c.WriteLayout(), ShouldBeNil)
+
+			So(read("domains.all.blacklist.conf"), ShouldEqual, "address=/bad.good.example.com/0.0.0.0\naddress=/example.com/0.0.0.0\naddress=/other.com/0.0.0.0\naddress=/y.example.com/10.0.0.1\nserver=/good.example.com/#\n")
+			_, err := os.Stat(filepath.Join(dir, "hosts.all.blacklist.conf"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,193 @@
+package edgeos
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Reload strategies
+const (
+	ReloadCustom  = "custom"  // run the ReloadCmd command
+	ReloadNone    = "none"    // no blacklist file changed, so dnsmasq is left alone
+	ReloadRestart = "restart" // run the DNSsvc command, dropping the dnsmasq cache
+	ReloadSignal  = "signal"  // SIGHUP dnsmasq, which only re-reads its addn-hosts files
+)
+
+// Reloaded describes how ReloadDNS reloaded dnsmasq
+type Reloaded struct {
+	Strategy string
+	Reason   string // why the configured strategy wasn't used
+	Took     time.Duration
+	Out      []byte
+}
+
+// String returns a one line summary of a reload
+func (r Reloaded) String() string {
+	var s string
+	switch r.Strategy {
+	case ReloadNone:
+		s = "dnsmasq not reloaded, no blacklist files changed"
+	default:
+		s = fmt.Sprintf("dnsmasq reloaded using %s strategy in %v", r.Strategy, r.Took.Round(time.Millisecond))
+	}
+
+	if r.Reason != "" {
+		s += " (" + r.Reason + ")"
+	}
+	return s
+}
+
+// fileSums returns a checksum of each live blacklist file
+func (c *Config) fileSums() (map[string]string, error) {
+	dns, data, err := c.liveFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make(map[string]string)
+	for _, f := range append(dns, data...) {
+		r, err := os.Open(f)
+		if err != nil {
+			return nil, err
+		}
+
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		sums[f] = string(h.Sum(nil))
+	}
+	return sums, nil
+}
+
+// Snapshot records the live blacklist files, so Changed can report what an update altered
+func (c *Config) Snapshot() (err error) {
+	c.sums, err = c.fileSums()
+	return err
+}
+
+// Changed returns the live blacklist files added, altered or removed since Snapshot
+func (c *Config) Changed() ([]string, error) {
+	if c.sums == nil {
+		return nil, errors.New("no blacklist file snapshot taken")
+	}
+
+	now, err := c.fileSums()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for f, sum := range now {
+		if c.sums[f] != sum {
+			changed = append(changed, f)
+		}
+	}
+
+	for f := range c.sums {
+		if _, ok := now[f]; !ok {
+			changed = append(changed, f)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// hupOnly reports whether dnsmasq re-reads every changed file on SIGHUP; it re-reads addn-hosts files,
+// but not its conf-dir, so any other change needs a restart
+func (c *Config) hupOnly(changed []string) bool {
+	for _, f := range changed {
+		if c.DataDir == "" || filepath.Dir(f) != filepath.Clean(c.DataDir) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReloadDNS reloads the dnsmasq configuration using the Reload strategy, skipping the reload
+// if Snapshot was taken and no blacklist file changed since, unless Force is set
+func (c *Config) ReloadDNS() (Reloaded, error) {
+	r := Reloaded{Strategy: c.Reload}
+	if r.Strategy == "" {
+		r.Strategy = ReloadRestart
+	}
+
+	changed, err := c.Changed()
+	switch {
+	case err != nil:
+		if r.Strategy == ReloadSignal {
+			r.Strategy, r.Reason = ReloadRestart, "unable to tell which files changed"
+		}
+	case len(changed) < 1 && !c.Force:
+		r.Strategy = ReloadNone
+		return r, nil
+	case r.Strategy == ReloadSignal && c.PidFile == "":
+		r.Strategy, r.Reason = ReloadRestart, "no dnsmasq PID file to signal"
+	case r.Strategy == ReloadSignal && !c.hupOnly(changed):
+		r.Strategy, r.Reason = ReloadRestart, "dnsmasq only re-reads addn-hosts files on SIGHUP"
+	}
+
+	// nolint
+	var (
+		bcmd    = c.Bash
+		dnssvc  = c.DNSsvc
+		pidFile = c.PidFile
+		custom  = c.ReloadCmd
+		start   = time.Now()
+	)
+	c = nil // workaround to release memory for ER-X
+
+	switch r.Strategy {
+	case ReloadRestart:
+		if dnssvc == "" {
+			return r, errors.New("restart reload strategy needs a dnsmasq service command")
+		}
+		r.Out, err = shell(bcmd, dnssvc)
+	case ReloadCustom:
+		if custom == "" {
+			return r, errors.New("custom reload strategy needs a reload command")
+		}
+		r.Out, err = shell(bcmd, custom)
+	case ReloadSignal:
+		err = hup(pidFile)
+	default:
+		return r, fmt.Errorf("unknown reload strategy %q, use %s, %s or %s", r.Strategy, ReloadRestart, ReloadSignal, ReloadCustom)
+	}
+
+	r.Took = time.Since(start)
+	return r, err
+}
+
+// shell runs a command through bash
+func shell(bash, command string) ([]byte, error) {
+	cmd := exec.Command(bash) // nolint
+	cmd.Stdin = strings.NewReader(command)
+	return cmd.CombinedOutput()
+}
+
+// hup sends SIGHUP to the process whose PID is in pidFile
+func hup(pidFile string) error {
+	b, err := os.ReadFile(pidFile)
+	if err != nil {
+		return fmt.Errorf("unable to read dnsmasq PID: %v", err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid < 1 {
+		return fmt.Errorf("invalid dnsmasq PID in %s: %q", pidFile, strings.TrimSpace(string(b)))
+	}
+	return syscall.Kill(pid, syscall.SIGHUP)
+}
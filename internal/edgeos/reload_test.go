@@ -0,0 +1,154 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReload(t *testing.T) {
+	Convey("Testing dnsmasq reload strategies", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			dns  = filepath.Join(dir, "dnsmasq.d")
+			data = filepath.Join(dir, "hosts")
+			conf = filepath.Join(dns, "domains.ads.blacklist.conf")
+			host = filepath.Join(data, "hosts.ads.hosts")
+			pid  = filepath.Join(dir, "dnsmasq.pid")
+		)
+		So(os.MkdirAll(dns, 0o755), ShouldBeNil)
+		So(os.MkdirAll(data, 0o755), ShouldBeNil)
+		So(ioutil.WriteFile(conf, []byte("address=/ads.example.com/0.0.0.0\n"), 0o644), ShouldBeNil)
+		So(ioutil.WriteFile(host, []byte("0.0.0.0 ads.example.com\n"), 0o644), ShouldBeNil)
+		So(ioutil.WriteFile(pid, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0o644), ShouldBeNil)
+
+		c := NewConfig(
+			Bash("/bin/bash"),
+			DataDir(data),
+			Dir(dns),
+			DNSsvc("true"),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			PidFile(pid),
+			Reload(ReloadSignal),
+			WCard(Wildcard{Node: "*s", Name: "*"}),
+		)
+
+		Convey("without a snapshot", func() {
+			r, err := c.ReloadDNS()
+			So(err, ShouldBeNil)
+			So(r.Strategy, ShouldEqual, ReloadRestart)
+			So(r.Reason, ShouldEqual, "unable to tell which files changed")
+		})
+
+		Convey("with a snapshot", func() {
+			So(c.Snapshot(), ShouldBeNil)
+
+			Convey("and nothing changed", func() {
+				r, err := c.ReloadDNS()
+				So(err, ShouldBeNil)
+				So(r.Strategy, ShouldEqual, ReloadNone)
+				So(r.String(), ShouldEqual, "dnsmasq not reloaded, no blacklist files changed")
+			})
+
+			Convey("and nothing changed with Force set", func() {
+				c.SetOpt(Force(true), Reload(ReloadRestart))
+				r, err := c.ReloadDNS()
+				So(err, ShouldBeNil)
+				So(r.Strategy, ShouldEqual, ReloadRestart)
+			})
+
+			Convey("and only an addn-hosts file changed", func() {
+				So(ioutil.WriteFile(host, []byte("0.0.0.0 tracker.example.com\n"), 0o644), ShouldBeNil)
+
+				hup := make(chan os.Signal, 1)
+				signal.Notify(hup, syscall.SIGHUP)
+				defer signal.Stop(hup)
+
+				r, err := c.ReloadDNS()
+				So(err, ShouldBeNil)
+				So(r.Strategy, ShouldEqual, ReloadSignal)
+				So(r.String(), ShouldStartWith, "dnsmasq reloaded using signal strategy in ")
+
+				select {
+				case <-hup:
+				case <-time.After(time.Second):
+					So("no SIGHUP received", ShouldBeEmpty)
+				}
+			})
+
+			Convey("and only an addn-hosts file changed without a PID file", func() {
+				So(ioutil.WriteFile(host, []byte("0.0.0.0 tracker.example.com\n"), 0o644), ShouldBeNil)
+				c.SetOpt(PidFile(""))
+
+				r, err := c.ReloadDNS()
+				So(err, ShouldBeNil)
+				So(r.Strategy, ShouldEqual, ReloadRestart)
+				So(r.Reason, ShouldEqual, "no dnsmasq PID file to signal")
+			})
+
+			Convey("and a target with only a PID file that needs a restart", func() {
+				So(os.Remove(conf), ShouldBeNil)
+				c.SetOpt(DNSsvc(""))
+
+				r, err := c.ReloadDNS()
+				So(r.Strategy, ShouldEqual, ReloadRestart)
+				So(err.Error(), ShouldEqual, "restart reload strategy needs a dnsmasq service command")
+			})
+
+			Convey("and a dnsmasq configuration file was removed", func() {
+				So(os.Remove(conf), ShouldBeNil)
+
+				changed, err := c.Changed()
+				So(err, ShouldBeNil)
+				So(changed, ShouldResemble, []string{conf})
+
+				r, err := c.ReloadDNS()
+				So(err, ShouldBeNil)
+				So(r.Strategy, ShouldEqual, ReloadRestart)
+				So(r.Reason, ShouldEqual, "dnsmasq only re-reads addn-hosts files on SIGHUP")
+			})
+
+			Convey("and the custom strategy", func() {
+				So(ioutil.WriteFile(conf, []byte("address=/tracker.example.com/0.0.0.0\n"), 0o644), ShouldBeNil)
+				c.SetOpt(Reload(ReloadCustom))
+
+				_, err := c.ReloadDNS()
+				So(err.Error(), ShouldEqual, "custom reload strategy needs a reload command")
+
+				c.SetOpt(ReloadCmd("echo reloaded"))
+				r, err := c.ReloadDNS()
+				So(err, ShouldBeNil)
+				So(r.Strategy, ShouldEqual, ReloadCustom)
+				So(string(r.Out), ShouldEqual, "reloaded\n")
+			})
+
+			Convey("and an unknown strategy", func() {
+				So(os.Remove(host), ShouldBeNil)
+				c.SetOpt(Reload("bounce"))
+
+				_, err := c.ReloadDNS()
+				So(err.Error(), ShouldEqual, `unknown reload strategy "bounce", use restart, signal or custom`)
+			})
+		})
+
+		Convey("with an unreadable PID file", func() {
+			So(c.Snapshot(), ShouldBeNil)
+			So(ioutil.WriteFile(host, []byte("0.0.0.0 tracker.example.com\n"), 0o644), ShouldBeNil)
+			So(ioutil.WriteFile(pid, []byte("dnsmasq\n"), 0o644), ShouldBeNil)
+
+			_, err := c.ReloadDNS()
+			So(err.Error(), ShouldEqual, fmt.Sprintf(`invalid dnsmasq PID in %s: "dnsmasq"`, pid))
+		})
+	})
+}
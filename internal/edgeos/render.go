@@ -0,0 +1,405 @@
+package edgeos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	blockMode    = "blocking-mode"
+	dnsmasqOut   = "dnsmasq"
+	hostsFileOut = "hosts-file"
+	outputs      = "output"
+	rpzFile      = "blacklist.rpz.zone"
+	modeLocal    = "local"
+	modeNoData   = "nodata"
+	modeNullIP   = "null-ip"
+	modeNXDomain = "nxdomain"
+	modeRefused  = "refused"
+	rpzOut       = "rpz"
+	unboundOut   = "unbound"
+)
+
+// blockModes lists the blocking modes each output renderer can express
+var blockModes = map[string][]string{
+	dnsmasqOut:   {modeLocal, modeNone, modeNullIP, modeNXDomain},
+	hostsFileOut: {modeNone, modeNullIP},
+	rpzOut:       {modeNoData, modeNullIP, modeNXDomain},
+	unboundOut:   {modeLocal, modeNoData, modeNullIP, modeNXDomain, modeRefused},
+}
+
+// getOutput returns the output renderer for a node, inheriting the root setting
+func (c tree) getOutput(node string) string {
+	if c.keyExists(node) && c[node].output != "" {
+		return c[node].output
+	}
+	if c.keyExists(rootNode) {
+		return c[rootNode].output
+	}
+	return ""
+}
+
+// getMode returns the blocking mode for a node, inheriting the root setting
+func (c tree) getMode(node string) string {
+	if c.keyExists(node) && c[node].mode != "" {
+		return c[node].mode
+	}
+	if c.keyExists(rootNode) {
+		return c[rootNode].mode
+	}
+	return ""
+}
+
+// checkModes returns an error if a node or source blocking mode can't be expressed by its output renderer
+func (c tree) checkModes() error {
+	for _, node := range []string{rootNode, domains, hosts} {
+		if !c.keyExists(node) {
+			continue
+		}
+
+		for _, s := range append([]*source{c[node]}, c[node].src...) {
+			mode, out := s.mode, s.output
+			if mode == "" {
+				mode = c.getMode(node)
+			}
+			if out == "" {
+				out = c.getOutput(node)
+			}
+			if out == "" {
+				out = dnsmasqOut
+			}
+
+			switch mode {
+			case "", modeLocal, modeNoData, modeNone, modeNullIP, modeNXDomain, modeRefused:
+			default:
+				return fmt.Errorf("invalid %s %q for %s, must be one of %s, %s, %s, %s, %s or %s", blockMode, mode, s.name, modeLocal, modeNoData, modeNone, modeNullIP, modeNXDomain, modeRefused)
+			}
+
+			if mode != "" && !modeSupported(out, mode) {
+				err := fmt.Errorf("%s %q for %s is not supported by %s output, use one of %s", blockMode, mode, s.name, out, strings.Join(blockModes[out], ", "))
+				if mode == modeNoData && (out == dnsmasqOut || out == hostsFileOut) {
+					err = fmt.Errorf("%v; dnsmasq can't answer NODATA for a domain, use %s or %s output", err, rpzOut, unboundOut)
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// modeSupported returns true if the output renderer can express the blocking mode
+func modeSupported(out, mode string) bool {
+	for _, m := range blockModes[out] {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// foreign returns true if an output renderer writes files for a resolver other than dnsmasq
+func foreign(out string) bool {
+	switch out {
+	case rpzOut, unboundOut:
+		return true
+	}
+	return false
+}
+
+// outputDir returns the directory an output renderer's files are written to; dnsmasq reads every file
+// in Dir, so output meant for other resolvers goes to OutDir
+func (e *Env) outputDir(out string) string {
+	if foreign(out) {
+		return e.OutDir
+	}
+	return e.Dir
+}
+
+// checkOutDir returns an error if a node or source renders output for another resolver without an OutDir
+func (c *Config) checkOutDir() error {
+	if c.OutDir != "" {
+		return nil
+	}
+
+	for _, node := range []string{rootNode, domains, hosts} {
+		if !c.tree.keyExists(node) {
+			continue
+		}
+
+		for _, s := range append([]*source{c.tree[node]}, c.tree[node].src...) {
+			out := s.output
+			if out == "" {
+				out = c.tree.getOutput(node)
+			}
+			if foreign(out) {
+				return fmt.Errorf("%s output for %s needs an output directory outside the dnsmasq directory", out, s.name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkOutputs returns an error if a node or source has an unsupported output renderer
+func (c tree) checkOutputs() error {
+	for _, node := range []string{rootNode, domains, hosts} {
+		if !c.keyExists(node) {
+			continue
+		}
+
+		srcs := append([]*source{c[node]}, c[node].src...)
+		for _, s := range srcs {
+			switch s.output {
+			case "", dnsmasqOut, hostsFileOut, rpzOut, unboundOut:
+			default:
+				return fmt.Errorf("invalid %s %q for %s, must be one of %s, %s, %s or %s", outputs, s.output, s.name, dnsmasqOut, hostsFileOut, rpzOut, unboundOut)
+			}
+		}
+	}
+	return nil
+}
+
+// newBList returns the files to write for a source's processed list
+func (s *source) newBList(area string, l *list, size int) *bList {
+	if !s.addnHosts() {
+		return &bList{file: s.filename(area), r: s.render(l), size: size}
+	}
+
+	data := s.hostsFile()
+	r := io.Reader(strings.NewReader("addn-hosts=" + liveName(data) + "\n"))
+	if sets := setLines(s); len(sets) > 0 {
+		r = io.MultiReader(r, formatData(strings.Join(sets, "\n"), l))
+	}
+
+	return &bList{
+		data: &bList{file: data, r: formatData(hostsFormat(s), l), size: size},
+		file: s.filename(area),
+		r:    r,
+		size: size,
+	}
+}
+
+// addnHosts returns true if a source's entries are written as a hosts file loaded with addn-hosts
+func (s *source) addnHosts() bool {
+	switch s.nType {
+	case host, preHost:
+	default:
+		return false
+	}
+
+	if s.output != hostsFileOut {
+		return false
+	}
+
+	switch s.mode {
+	case "", modeNullIP:
+	default:
+		return false
+	}
+
+	if s.DataDir == "" {
+		s.Log.Warningf("%s: %s output needs a data directory, using address= lines", s.name, hostsFileOut)
+		return false
+	}
+	return true
+}
+
+// hostsFormat returns the hosts file format for each of a source's redirect addresses
+func hostsFormat(s *source) string {
+	if s.ip6 != "" {
+		return s.ip + " %[1]v\n" + s.ip6 + " %[1]v"
+	}
+	return s.ip + " %v"
+}
+
+// hostsFile returns the path of a source's addn-hosts file
+func (s *source) hostsFile() string {
+	return filepath.Join(s.DataDir, fmt.Sprintf("%s.%s.hosts", s.area(), s.name))
+}
+
+// render returns the source's processed list formatted for its output renderer
+func (s *source) render(l *list) io.Reader {
+	switch s.output {
+	case rpzOut:
+		return formatData(getRPZFormat(s), l)
+	case unboundOut:
+		return io.MultiReader(strings.NewReader("server:\n"), formatData(getUnboundFormat(s), l))
+	}
+	return formatData(getDnsmasqPrefix(s), l)
+}
+
+// getUnboundFormat returns the Unbound local-zone/local-data format for a source
+func getUnboundFormat(s *source) string {
+	switch {
+	case s.nType == excDomn, s.nType == excHost, s.nType == excRoot:
+		return `local-zone: "%[1]v." transparent`
+	case s.mode == modeLocal:
+		return `local-zone: "%[1]v." static`
+	case s.mode == modeNoData:
+		return `local-zone: "%[1]v." always_nodata`
+	case s.mode == modeRefused:
+		return `local-zone: "%[1]v." always_refuse`
+	case s.mode == modeNXDomain, s.ip == "" && s.ip6 == "":
+		return `local-zone: "%[1]v." always_nxdomain`
+	case s.nType == host, s.nType == preHost:
+		return localData(s)
+	}
+	return `local-zone: "%[1]v." redirect` + "\n" + localData(s)
+}
+
+// localData returns an Unbound local-data record for each of a source's redirect addresses
+func localData(s *source) string {
+	var data []string
+	for _, ip := range []string{s.ip, s.ip6} {
+		if ip != "" {
+			data = append(data, `local-data: "%[1]v. `+rrType(ip)+" "+ip+`"`)
+		}
+	}
+	return strings.Join(data, "\n")
+}
+
+// getRPZFormat returns the RPZ record format for a source, using names relative to the zone origin
+func getRPZFormat(s *source) string {
+	names := []string{"%[1]v", "*.%[1]v"}
+	actions := rpzActions(s)
+
+	switch s.nType {
+	case excDomn, excHost, excRoot:
+		actions = []string{"CNAME rpz-passthru."}
+	case host, preHost:
+		names = names[:1]
+	}
+
+	var recs []string
+	for _, name := range names {
+		for _, a := range actions {
+			recs = append(recs, name+" "+a)
+		}
+	}
+	return strings.Join(recs, "\n")
+}
+
+// rpzActions returns the RPZ policy record data for a source's blocking mode and redirect addresses,
+// NXDOMAIN if no mode is set and none of the addresses are specific
+func rpzActions(s *source) []string {
+	switch s.mode {
+	case modeNoData:
+		return []string{"CNAME *."}
+	case modeNXDomain:
+		return []string{"CNAME ."}
+	}
+
+	var a []string
+	for _, ip := range []string{s.ip, s.ip6} {
+		if p := net.ParseIP(ip); p != nil && (s.mode == modeNullIP || !p.IsUnspecified()) {
+			a = append(a, rrType(ip)+" "+ip)
+		}
+	}
+
+	if len(a) < 1 {
+		return []string{"CNAME ."}
+	}
+	return a
+}
+
+// rpzFragments returns the RPZ files written for every node and source
+func (c *Config) rpzFragments() []string {
+	var files []string
+	for _, n := range c.sortKeys() {
+		srcs := append([]*source{c.addInc(n)}, c.addExc(n).src...)
+		srcs = append(srcs, c.tree.validate(n).src...)
+
+		for _, s := range srcs {
+			if s.output != rpzOut {
+				continue
+			}
+
+			s.Env = c.Env
+			f := s.filename(typeInt(s.nType))
+			if _, err := os.Stat(f); err == nil {
+				files = append(files, f)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// rpzSerial returns the SOA serial and content hash recorded in an RPZ master zone file
+func rpzSerial(file string) (serial int64, sum string) {
+	b, err := ioutil.ReadFile(file) // nolint
+	if err != nil {
+		return 0, ""
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		f := strings.Fields(line)
+		switch {
+		case len(f) == 4 && f[0] == ";" && f[1] == "content" && f[2] == "sha256":
+			sum = f[3]
+		case len(f) > 5 && f[2] == "SOA":
+			serial, _ = strconv.ParseInt(f[5], 10, 64)
+		}
+	}
+	return serial, sum
+}
+
+// WriteRPZ writes an RPZ master zone file to OutDir that $INCLUDEs each RPZ file; the serial is only bumped
+// when the included content changes, so an unchanged zone isn't transferred or reloaded
+func (c *Config) WriteRPZ() error {
+	if err := c.checkOutDir(); err != nil {
+		return err
+	}
+
+	files := c.rpzFragments()
+	if len(files) < 1 {
+		return nil
+	}
+
+	h := sha256.New()
+	body := &strings.Builder{}
+	for _, f := range files {
+		fmt.Fprintf(body, "$INCLUDE %s\n", liveName(f))
+
+		b, err := ioutil.ReadFile(f) // nolint
+		if err != nil {
+			return err
+		}
+		h.Write(b)
+	}
+	h.Write([]byte(body.String()))
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	file := filepath.Join(c.OutDir, rpzFile)
+	serial, last := rpzSerial(liveName(file))
+	if sum != last {
+		if now := time.Now().Unix(); now > serial {
+			serial = now
+		} else {
+			serial++
+		}
+	}
+
+	zone := &strings.Builder{}
+	fmt.Fprintf(zone, "; content sha256 %s\n$TTL 300\n@ IN SOA localhost. root.localhost. %d 3600 600 86400 300\n@ IN NS localhost.\n%s", sum, serial, body)
+
+	b := &bList{file: file, r: strings.NewReader(zone.String()), size: len(files)}
+	return b.writeFile()
+}
+
+// rrType returns the DNS record type for an IP address
+func rrType(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "AAAA"
+	}
+	return "A"
+}
@@ -0,0 +1,430 @@
+package edgeos
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRender(t *testing.T) {
+	Convey("Testing render()", t, func() {
+		env := &Env{Pfx: dnsPfx{domain: "address=", host: "server="}}
+		l := &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+		l.set([]byte("ads.example.com"))
+		l.set([]byte("track.example.com"))
+
+		tests := []struct {
+			exp  string
+			name string
+			s    *source
+		}{
+			{
+				name: "dnsmasq domains",
+				s:    &source{Env: env, ip: "0.0.0.0", nType: domn},
+				exp:  "address=/ads.example.com/0.0.0.0\naddress=/track.example.com/0.0.0.0\n",
+			},
+			{
+				name: "dnsmasq domains with an IPv6 redirect",
+				s:    &source{Env: env, ip: "0.0.0.0", ip6: "::", nType: domn},
+				exp: "address=/ads.example.com/0.0.0.0\naddress=/ads.example.com/::\n" +
+					"address=/track.example.com/0.0.0.0\naddress=/track.example.com/::\n",
+			},
+			{
+				name: "dnsmasq exclusions with an IPv6 redirect",
+				s:    &source{Env: env, ip: "0.0.0.0", ip6: "::", nType: excHost},
+				exp:  "server=/ads.example.com/#\nserver=/track.example.com/#\n",
+			},
+			{
+				name: "unbound hosts with both redirects",
+				s:    &source{Env: env, ip: "192.168.1.1", ip6: "fd00::1", nType: preHost, output: unboundOut},
+				exp: "server:\n" +
+					"local-data: \"ads.example.com. A 192.168.1.1\"\nlocal-data: \"ads.example.com. AAAA fd00::1\"\n" +
+					"local-data: \"track.example.com. A 192.168.1.1\"\nlocal-data: \"track.example.com. AAAA fd00::1\"\n",
+			},
+			{
+				name: "rpz domains with both redirects",
+				s:    &source{Env: env, ip: "192.168.1.1", ip6: "fd00::1", nType: root, output: rpzOut},
+				exp: "ads.example.com A 192.168.1.1\nads.example.com AAAA fd00::1\n*.ads.example.com A 192.168.1.1\n*.ads.example.com AAAA fd00::1\n" +
+					"track.example.com A 192.168.1.1\ntrack.example.com AAAA fd00::1\n*.track.example.com A 192.168.1.1\n*.track.example.com AAAA fd00::1\n",
+			},
+			{
+				name: "rpz hosts with unspecified redirects",
+				s:    &source{Env: env, ip: "0.0.0.0", ip6: "::", nType: host, output: rpzOut},
+				exp:  "ads.example.com CNAME .\ntrack.example.com CNAME .\n",
+			},
+			{
+				name: "dnsmasq nxdomain mode",
+				s:    &source{Env: env, ip: "0.0.0.0", ip6: "::", mode: modeNXDomain, nType: domn},
+				exp:  "address=/ads.example.com/\naddress=/track.example.com/\n",
+			},
+			{
+				name: "dnsmasq local mode",
+				s:    &source{Env: env, ip: "0.0.0.0", mode: modeLocal, nType: host},
+				exp:  "local=/ads.example.com/\nlocal=/track.example.com/\n",
+			},
+			{
+				name: "unbound nodata mode",
+				s:    &source{Env: env, ip: "0.0.0.0", mode: modeNoData, nType: domn, output: unboundOut},
+				exp:  "server:\nlocal-zone: \"ads.example.com.\" always_nodata\nlocal-zone: \"track.example.com.\" always_nodata\n",
+			},
+			{
+				name: "unbound refused mode",
+				s:    &source{Env: env, ip: "0.0.0.0", mode: modeRefused, nType: host, output: unboundOut},
+				exp:  "server:\nlocal-zone: \"ads.example.com.\" always_refuse\nlocal-zone: \"track.example.com.\" always_refuse\n",
+			},
+			{
+				name: "unbound nxdomain mode",
+				s:    &source{Env: env, ip: "0.0.0.0", mode: modeNXDomain, nType: domn, output: unboundOut},
+				exp:  "server:\nlocal-zone: \"ads.example.com.\" always_nxdomain\nlocal-zone: \"track.example.com.\" always_nxdomain\n",
+			},
+			{
+				name: "unbound local mode",
+				s:    &source{Env: env, ip: "0.0.0.0", mode: modeLocal, nType: domn, output: unboundOut},
+				exp:  "server:\nlocal-zone: \"ads.example.com.\" static\nlocal-zone: \"track.example.com.\" static\n",
+			},
+			{
+				name: "rpz nodata mode",
+				s:    &source{Env: env, ip: "0.0.0.0", mode: modeNoData, nType: host, output: rpzOut},
+				exp:  "ads.example.com CNAME *.\ntrack.example.com CNAME *.\n",
+			},
+			{
+				name: "rpz null-ip mode",
+				s:    &source{Env: env, ip: "0.0.0.0", mode: modeNullIP, nType: host, output: rpzOut},
+				exp:  "ads.example.com A 0.0.0.0\ntrack.example.com A 0.0.0.0\n",
+			},
+			{
+				name: "unbound domains",
+				s:    &source{Env: env, ip: "192.168.1.1", nType: domn, output: unboundOut},
+				exp: "server:\n" +
+					"local-zone: \"ads.example.com.\" redirect\nlocal-data: \"ads.example.com. A 192.168.1.1\"\n" +
+					"local-zone: \"track.example.com.\" redirect\nlocal-data: \"track.example.com. A 192.168.1.1\"\n",
+			},
+			{
+				name: "unbound hosts with an IPv6 redirect",
+				s:    &source{Env: env, ip: "::1", nType: host, output: unboundOut},
+				exp:  "server:\nlocal-data: \"ads.example.com. AAAA ::1\"\nlocal-data: \"track.example.com. AAAA ::1\"\n",
+			},
+			{
+				name: "unbound without a redirect IP",
+				s:    &source{Env: env, nType: preDomn, output: unboundOut},
+				exp:  "server:\nlocal-zone: \"ads.example.com.\" always_nxdomain\nlocal-zone: \"track.example.com.\" always_nxdomain\n",
+			},
+			{
+				name: "unbound exclusions",
+				s:    &source{Env: env, ip: "0.0.0.0", nType: excDomn, output: unboundOut},
+				exp:  "server:\nlocal-zone: \"ads.example.com.\" transparent\nlocal-zone: \"track.example.com.\" transparent\n",
+			},
+			{
+				name: "rpz domains",
+				s:    &source{Env: env, ip: "0.0.0.0", nType: domn, output: rpzOut},
+				exp: "ads.example.com CNAME .\n*.ads.example.com CNAME .\n" +
+					"track.example.com CNAME .\n*.track.example.com CNAME .\n",
+			},
+			{
+				name: "rpz hosts with a redirect IP",
+				s:    &source{Env: env, ip: "192.168.1.1", nType: host, output: rpzOut},
+				exp:  "ads.example.com A 192.168.1.1\ntrack.example.com A 192.168.1.1\n",
+			},
+			{
+				name: "rpz exclusions",
+				s:    &source{Env: env, ip: "0.0.0.0", nType: excRoot, output: rpzOut},
+				exp: "ads.example.com CNAME rpz-passthru.\n*.ads.example.com CNAME rpz-passthru.\n" +
+					"track.example.com CNAME rpz-passthru.\n*.track.example.com CNAME rpz-passthru.\n",
+			},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				act, err := io.ReadAll(tt.s.render(l))
+				So(err, ShouldBeNil)
+				So(string(act), ShouldEqual, tt.exp)
+			})
+		}
+	})
+}
+
+func TestGetOutput(t *testing.T) {
+	Convey("Testing output renderer inheritance", t, func() {
+		cfg := `blacklist {
+    dns-redirect-ip 0.0.0.0
+    output unbound
+    exclude good.example.com
+    domains {
+        source ads {
+            url https://lists.example.com/ads.txt
+        }
+    }
+    hosts {
+        output dnsmasq
+        source local {
+            output unbound
+            url https://lists.example.com/hosts.txt
+        }
+        source tracking {
+            url https://lists.example.com/tracking.txt
+        }
+    }
+}`
+		c := NewConfig(Dir("/etc/dnsmasq.d"), Ext("blacklist.conf"), OutDir("/tmp/blacklist.out"))
+		So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+
+		So(c.Get(domains).Filter(urls).src[0].output, ShouldEqual, unboundOut)
+		h := c.Get(hosts).Filter(urls).src
+		So(h[0].output, ShouldEqual, unboundOut)
+		So(h[1].output, ShouldEqual, dnsmasqOut)
+		So(c.addExc(rootNode).src[0].output, ShouldEqual, unboundOut)
+		So(c.addInc(hosts).output, ShouldEqual, dnsmasqOut)
+		So(make(tree).getOutput(domains), ShouldEqual, "")
+
+		Convey("with an unsupported output", func() {
+			cfg := `blacklist {
+    domains {
+        source ads {
+            output bind
+            url https://lists.example.com/ads.txt
+        }
+    }
+}`
+			So(NewConfig().Blacklist(&CFGstatic{Cfg: cfg}).Error(), ShouldEqual, `invalid output "bind" for ads, must be one of dnsmasq, hosts-file, rpz or unbound`)
+		})
+
+		Convey("with unbound output and no output directory", func() {
+			So(NewConfig(Dir("/etc/dnsmasq.d")).Blacklist(&CFGstatic{Cfg: cfg}).Error(), ShouldEqual, "unbound output for blacklist needs an output directory outside the dnsmasq directory")
+		})
+
+		Convey("with unbound files written to the output directory", func() {
+			So(c.GetAll().Files().Strings(), ShouldResemble, []string{
+				"/etc/dnsmasq.d/hosts.blacklisted-servers.blacklist.conf",
+				"/etc/dnsmasq.d/hosts.tracking.blacklist.conf",
+				"/tmp/blacklist.out/domains.ads.blacklist.conf",
+				"/tmp/blacklist.out/domains.blacklisted-subdomains.blacklist.conf",
+				"/tmp/blacklist.out/hosts.local.blacklist.conf",
+				"/tmp/blacklist.out/roots.global-blacklisted-domains.blacklist.conf",
+			})
+		})
+	})
+}
+
+func TestCheckModes(t *testing.T) {
+	Convey("Testing blocking-mode validation", t, func() {
+		tests := []struct {
+			err  string
+			mode string
+			name string
+			out  string
+		}{
+			{name: "dnsmasq null-ip", mode: modeNullIP},
+			{name: "dnsmasq nxdomain", mode: modeNXDomain},
+			{name: "dnsmasq local", mode: modeLocal},
+			{name: "dnsmasq nodata", mode: modeNoData, err: `blocking-mode "nodata" for domains is not supported by dnsmasq output, use one of local, none, null-ip, nxdomain; dnsmasq can't answer NODATA for a domain, use rpz or unbound output`},
+			{name: "dnsmasq refused", mode: modeRefused, err: `blocking-mode "refused" for domains is not supported by dnsmasq output, use one of local, none, null-ip, nxdomain`},
+			{name: "hosts-file nodata", mode: modeNoData, out: hostsFileOut, err: `blocking-mode "nodata" for domains is not supported by hosts-file output, use one of none, null-ip; dnsmasq can't answer NODATA for a domain, use rpz or unbound output`},
+			{name: "hosts-file null-ip", mode: modeNullIP, out: hostsFileOut},
+			{name: "hosts-file local", mode: modeLocal, out: hostsFileOut, err: `blocking-mode "local" for domains is not supported by hosts-file output, use one of none, null-ip`},
+			{name: "hosts-file nxdomain", mode: modeNXDomain, out: hostsFileOut, err: `blocking-mode "nxdomain" for domains is not supported by hosts-file output, use one of none, null-ip`},
+			{name: "unbound refused", mode: modeRefused, out: unboundOut},
+			{name: "rpz nodata", mode: modeNoData, out: rpzOut},
+			{name: "rpz local", mode: modeLocal, out: rpzOut, err: `blocking-mode "local" for domains is not supported by rpz output, use one of nodata, null-ip, nxdomain`},
+			{name: "an invalid mode", mode: "sinkhole", err: `invalid blocking-mode "sinkhole" for domains, must be one of local, nodata, none, null-ip, nxdomain or refused`},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				out := ""
+				if tt.out != "" {
+					out = "output " + tt.out
+				}
+
+				cfg := fmt.Sprintf(`blacklist {
+    %s
+    domains {
+        blocking-mode %s
+        source ads {
+            url https://lists.example.com/ads.txt
+        }
+    }
+}`, out, tt.mode)
+				c := NewConfig(OutDir("/tmp/blacklist.out"))
+				err := c.Blacklist(&CFGstatic{Cfg: cfg})
+				switch tt.err {
+				case "":
+					So(err, ShouldBeNil)
+					So(c.Get(domains).Filter(urls).src[0].mode, ShouldEqual, tt.mode)
+				default:
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldEqual, tt.err)
+				}
+			})
+		}
+	})
+}
+
+func TestWriteRPZ(t *testing.T) {
+	Convey("Testing WriteRPZ()", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		cfg := `blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        output rpz
+        source ads {
+            url https://lists.example.com/ads.txt
+        }
+        source empty {
+            url https://lists.example.com/empty.txt
+        }
+    }
+    hosts {
+        source tracking {
+            url https://lists.example.com/tracking.txt
+        }
+    }
+}`
+		out := dir + "/blacklist.out"
+		So(os.MkdirAll(out, 0o755), ShouldBeNil)
+
+		c := NewConfig(Dir(dir), Ext("blacklist.conf"), FileNameFmt("%v/%v.%v.%v"), OutDir(out))
+		So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+
+		Convey("with no RPZ files written", func() {
+			So(c.WriteRPZ(), ShouldBeNil)
+			_, err := os.Stat(out + "/" + rpzFile)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("with no output directory", func() {
+			c.SetOpt(OutDir(""))
+			err := c.WriteRPZ()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "rpz output for domains needs an output directory outside the dnsmasq directory")
+			_, err = os.Stat(rpzFile)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("with RPZ files written", func() {
+			for _, f := range []string{"domains.ads", "hosts.tracking"} {
+				So(ioutil.WriteFile(out+"/"+f+".blacklist.conf", []byte("ads.example.com CNAME .\n"), 0o644), ShouldBeNil)
+			}
+
+			So(c.WriteRPZ(), ShouldBeNil)
+			_, err := os.Stat(dir + "/" + rpzFile)
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			b, err := ioutil.ReadFile(out + "/" + rpzFile)
+			So(err, ShouldBeNil)
+
+			act := strings.Split(string(b), "\n")
+			So(act[0], ShouldStartWith, "; content sha256 ")
+			So(act[1], ShouldEqual, "$TTL 300")
+			So(act[2], ShouldStartWith, "@ IN SOA localhost. root.localhost. ")
+			So(act[3], ShouldEqual, "@ IN NS localhost.")
+			So(act[4:], ShouldResemble, []string{"$INCLUDE " + out + "/domains.ads.blacklist.conf", ""})
+
+			serial, sum := rpzSerial(out + "/" + rpzFile)
+			So(serial, ShouldBeGreaterThan, 0)
+
+			Convey("with unchanged content keeping the serial", func() {
+				So(c.WriteRPZ(), ShouldBeNil)
+				s, h := rpzSerial(out + "/" + rpzFile)
+				So(s, ShouldEqual, serial)
+				So(h, ShouldEqual, sum)
+			})
+
+			Convey("with changed content bumping the serial", func() {
+				So(ioutil.WriteFile(out+"/domains.ads.blacklist.conf", []byte("tracker.example.com CNAME .\n"), 0o644), ShouldBeNil)
+				So(c.WriteRPZ(), ShouldBeNil)
+				s, h := rpzSerial(out + "/" + rpzFile)
+				So(s, ShouldBeGreaterThan, serial)
+				So(h, ShouldNotEqual, sum)
+			})
+		})
+	})
+}
+
+func TestAddnHosts(t *testing.T) {
+	Convey("Testing hosts-file output", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(os.MkdirAll(dir+"/dnsmasq.d", 0o755), ShouldBeNil)
+
+		cfg := `blacklist {
+    dns-redirect-ip 0.0.0.0
+    output hosts-file
+    domains {
+        source ads {
+            url https://lists.example.com/ads.txt
+        }
+    }
+    hosts {
+        source local {
+            url https://lists.example.com/hosts.txt
+        }
+    }
+}`
+		newCfg := func(data string) *Config {
+			c := NewConfig(
+				DataDir(data),
+				Dir(dir+"/dnsmasq.d"),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+			return c
+		}
+
+		process := func(c *Config, node string) *bList {
+			s := c.Get(node).Filter(urls).src[0]
+			s.Env = c.Env
+			s.r = strings.NewReader("ads.example.com\ntrack.example.com\n")
+			c.ctr.stat[typeInt(s.nType)] = &stats{}
+			return s.process()
+		}
+
+		Convey("with host entries written to an addn-hosts file", func() {
+			So(process(newCfg(dir+"/hosts"), hosts).writeFile(), ShouldBeNil)
+
+			b, err := ioutil.ReadFile(dir + "/dnsmasq.d/hosts.local.blacklist.conf")
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "addn-hosts="+dir+"/hosts/hosts.local.hosts\n")
+
+			b, err = ioutil.ReadFile(dir + "/hosts/hosts.local.hosts")
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "0.0.0.0 ads.example.com\n0.0.0.0 track.example.com\n")
+		})
+
+		Convey("with domain entries kept as address= lines", func() {
+			act, err := io.ReadAll(process(newCfg(dir+"/hosts"), domains).r)
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, "address=/ads.example.com/0.0.0.0\naddress=/track.example.com/0.0.0.0\n")
+		})
+
+		Convey("with an IPv6 redirect added to the addn-hosts file", func() {
+			c := newCfg(dir + "/hosts")
+			c.tree[rootNode].ip6 = "::"
+			So(process(c, hosts).writeFile(), ShouldBeNil)
+
+			b, err := ioutil.ReadFile(dir + "/hosts/hosts.local.hosts")
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "0.0.0.0 ads.example.com\n:: ads.example.com\n0.0.0.0 track.example.com\n:: track.example.com\n")
+		})
+
+		Convey("with no data directory", func() {
+			b := process(newCfg(""), hosts)
+			So(b.data, ShouldBeNil)
+			act, err := io.ReadAll(b.r)
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, "address=/ads.example.com/0.0.0.0\naddress=/track.example.com/0.0.0.0\n")
+		})
+	})
+}
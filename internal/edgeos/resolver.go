@@ -0,0 +1,169 @@
+package edgeos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	resolverFallback = "resolver-fallback"
+	resolverProto    = "resolver-protocol"
+	resolvers        = "resolver"
+	resolverTimeout  = 3 * time.Second
+)
+
+// systemResolver is used when resolver-fallback is enabled and every bootstrap resolver fails
+var systemResolver = net.DefaultResolver
+
+// resolverOpts holds the bootstrap resolver settings used to look up source hosts
+type resolverOpts struct {
+	fallback string
+	proto    string
+	servers  []string
+}
+
+// set assigns a bootstrap resolver setting from a configuration leaf
+func (r *resolverOpts) set(k, v string) {
+	switch k {
+	case resolverFallback:
+		r.fallback = v
+	case resolverProto:
+		r.proto = v
+	case resolvers:
+		r.servers = append(r.servers, v)
+	}
+}
+
+// validate returns an error if a bootstrap resolver setting is invalid
+func (r resolverOpts) validate() error {
+	switch r.proto {
+	case "", "tcp", "udp":
+	default:
+		return fmt.Errorf("invalid %s %q, must be either tcp or udp", resolverProto, r.proto)
+	}
+
+	if r.fallback != "" {
+		if _, err := strToBool(r.fallback); err != nil {
+			return fmt.Errorf("invalid %s %q", resolverFallback, r.fallback)
+		}
+	}
+
+	for _, srv := range r.servers {
+		if _, err := resolverAddr(srv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolverAddr returns a resolver's ip:port, defaulting to port 53
+func resolverAddr(srv string) (string, error) {
+	if ip := net.ParseIP(srv); ip != nil {
+		return net.JoinHostPort(srv, "53"), nil
+	}
+
+	host, _, err := net.SplitHostPort(srv)
+	if err != nil || net.ParseIP(host) == nil {
+		return "", fmt.Errorf("invalid %s %q, must be an IP address or ip:port", resolvers, srv)
+	}
+	return srv, nil
+}
+
+// using returns a *net.Resolver that only queries srv
+func (r resolverOpts) using(srv string) *net.Resolver {
+	proto := r.proto
+	if proto == "" {
+		proto = "udp"
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			d := &net.Dialer{Timeout: resolverTimeout}
+			return d.DialContext(ctx, proto, srv)
+		},
+	}
+}
+
+// lookup resolves host with each bootstrap resolver in turn, then the system resolver if resolver-fallback is enabled
+func (r resolverOpts) lookup(ctx context.Context, host string) ([]string, error) {
+	var (
+		addrs []string
+		err   = errors.New("no resolvers")
+	)
+
+	for _, srv := range r.servers {
+		var addr string
+		if addr, err = resolverAddr(srv); err != nil {
+			return nil, err
+		}
+
+		lctx, cancel := context.WithTimeout(ctx, resolverTimeout)
+		addrs, err = r.using(addr).LookupHost(lctx, host)
+		cancel()
+		if err == nil {
+			return addrs, nil
+		}
+	}
+
+	if ok, _ := strToBool(r.fallback); ok {
+		return systemResolver.LookupHost(ctx, host)
+	}
+	return nil, fmt.Errorf("unable to resolve %s using %s: %v", host, resolvers, err)
+}
+
+// dialContext returns a DialContext func that looks up hosts with the bootstrap resolvers;
+// a non-empty network overrides the one requested by the caller
+func (r resolverOpts) dialContext(d *net.Dialer, network string) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, n, addr string) (net.Conn, error) {
+		if network != "" {
+			n = network
+		}
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || len(r.servers) < 1 || net.ParseIP(host) != nil {
+			return d.DialContext(ctx, n, addr)
+		}
+
+		ips, err := r.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		err = fmt.Errorf("no %s addresses found for %s", n, host)
+		for _, ip := range ips {
+			if !netMatch(n, ip) {
+				continue
+			}
+
+			var conn net.Conn
+			if conn, err = d.DialContext(ctx, n, net.JoinHostPort(ip, port)); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// netMatch returns true if ip can be dialled using network
+func netMatch(network, ip string) bool {
+	v4 := net.ParseIP(ip).To4() != nil
+	switch network {
+	case "tcp4", "udp4":
+		return v4
+	case "tcp6", "udp6":
+		return !v4
+	}
+	return true
+}
+
+// getResolver returns the bootstrap resolver settings
+func (c tree) getResolver() resolverOpts {
+	if c.keyExists(rootNode) {
+		return c[rootNode].resolver
+	}
+	return resolverOpts{}
+}
@@ -0,0 +1,200 @@
+package edgeos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// dnsAnswer answers A queries for name with 127.0.0.1 and NXDOMAIN for anything else
+func dnsAnswer(name string, q []byte) []byte {
+	if len(q) < 12 {
+		return nil
+	}
+
+	var (
+		i     = 12
+		label []string
+	)
+	for i < len(q) && q[i] != 0 {
+		n := int(q[i])
+		if i+1+n > len(q) {
+			return nil
+		}
+		label = append(label, string(q[i+1:i+1+n]))
+		i += n + 1
+	}
+	if i+5 > len(q) {
+		return nil
+	}
+	question := q[12 : i+5]
+	qtype := binary.BigEndian.Uint16(q[i+1 : i+3])
+
+	r := &bytes.Buffer{}
+	r.Write(q[0:2])
+	switch {
+	case !strings.EqualFold(strings.Join(label, "."), name):
+		r.Write([]byte{0x81, 0x83, 0, 1, 0, 0, 0, 0, 0, 0})
+		r.Write(question)
+	case qtype == 1:
+		r.Write([]byte{0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0})
+		r.Write(question)
+		r.Write([]byte{0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 127, 0, 0, 1})
+	default:
+		r.Write([]byte{0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0})
+		r.Write(question)
+	}
+	return r.Bytes()
+}
+
+// fakeDNS starts UDP and TCP DNS responders for name on the same port and returns their address
+func fakeDNS(name string) (string, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	So(err, ShouldBeNil)
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	So(err, ShouldBeNil)
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = pc.WriteTo(dnsAnswer(name, buf[:n]), addr)
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					l := make([]byte, 2)
+					if _, err := io.ReadFull(conn, l); err != nil {
+						return
+					}
+					q := make([]byte, binary.BigEndian.Uint16(l))
+					if _, err := io.ReadFull(conn, q); err != nil {
+						return
+					}
+					r := dnsAnswer(name, q)
+					binary.BigEndian.PutUint16(l, uint16(len(r)))
+					_, _ = conn.Write(append(l, r...))
+				}
+			}(conn)
+		}
+	}()
+
+	return pc.LocalAddr().String(), func() { pc.Close(); ln.Close() }
+}
+
+func TestBootstrapResolver(t *testing.T) {
+	Convey("Testing download() with bootstrap resolvers", t, func() {
+		const host = "blocked.example.test"
+
+		srv := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "resolved.example.com")
+			},
+		))
+		defer srv.Close()
+
+		dns, stop := fakeDNS(host)
+		defer stop()
+
+		_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+		u := fmt.Sprintf("http://%s:%s/domains.txt", host, port)
+
+		dead, err := net.ListenPacket("udp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		deadAddr := dead.LocalAddr().String()
+		dead.Close()
+
+		tests := []struct {
+			err    string
+			exp    string
+			name   string
+			r      resolverOpts
+			system bool
+		}{
+			{name: "a UDP resolver", r: resolverOpts{servers: []string{dns}}, exp: "resolved.example.com"},
+			{name: "a TCP resolver", r: resolverOpts{proto: "tcp", servers: []string{dns}}, exp: "resolved.example.com"},
+			{name: "a dead resolver followed by a working one", r: resolverOpts{servers: []string{deadAddr, dns}}, exp: "resolved.example.com"},
+			{name: "only a dead resolver", r: resolverOpts{servers: []string{deadAddr}}, err: "unable to resolve " + host + " using resolver"},
+			{name: "a dead resolver and system fallback", r: resolverOpts{fallback: True, servers: []string{deadAddr}}, system: true, exp: "resolved.example.com"},
+			{name: "an invalid resolver", r: resolverOpts{servers: []string{"dns.example.com"}}, err: `invalid resolver "dns.example.com", must be an IP address or ip:port`},
+			{name: "an invalid protocol", r: resolverOpts{proto: "quic", servers: []string{dns}}, err: `invalid resolver-protocol "quic", must be either tcp or udp`},
+			{name: "an invalid fallback", r: resolverOpts{fallback: "maybe", servers: []string{dns}}, err: `invalid resolver-fallback "maybe"`},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				if tt.system {
+					orig := systemResolver
+					systemResolver = resolverOpts{}.using(dns)
+					defer func() { systemResolver = orig }()
+				}
+
+				o := download(&source{
+					Env:      &Env{Log: newLog(), Method: "GET"},
+					name:     "bootstrap",
+					resolver: tt.r,
+					url:      u,
+				})
+
+				switch tt.err {
+				case "":
+					So(o.err, ShouldBeNil)
+				default:
+					So(o.err, ShouldNotBeNil)
+					So(o.err.Error(), ShouldContainSubstring, tt.err)
+				}
+
+				act, err := io.ReadAll(o.r)
+				So(err, ShouldBeNil)
+				So(string(act), ShouldEqual, tt.exp)
+			})
+		}
+
+		Convey("with resolvers configured at the root node", func() {
+			cfg := fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+    probe-target %s:%s
+    resolver %s
+    resolver-fallback false
+    resolver-protocol tcp
+    domains {
+        source bootstrap {
+            url %s
+        }
+    }
+}`, host, port, dns, u)
+			c := NewConfig(Logger(newLog()))
+			So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+
+			s := c.Get(domains).Filter(urls).src[0]
+			So(s.resolver, ShouldResemble, resolverOpts{fallback: False, proto: "tcp", servers: []string{dns}})
+			So(c.Probe(), ShouldBeNil)
+			So(c.String(), ShouldContainSubstring, `"resolver-protocol": "tcp",`)
+		})
+
+		Convey("with tcp6 excluding IPv4 answers", func() {
+			So(netMatch("tcp6", "127.0.0.1"), ShouldBeFalse)
+			So(netMatch("tcp4", "::1"), ShouldBeFalse)
+			So(netMatch("tcp", "::1"), ShouldBeTrue)
+		})
+	})
+}
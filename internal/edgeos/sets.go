@@ -0,0 +1,218 @@
+package edgeos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	ipsetFile = "blacklist.ipset"
+	ipsets    = "ipset"
+	modeNone  = "none"
+	nftFile   = "blacklist.nft"
+	nftsets   = "nftset"
+	setDefs   = "set-definitions"
+)
+
+var (
+	ipsetName = regexp.MustCompile(`^[\w.-]{1,30}$`)
+	nftSpec   = regexp.MustCompile(`^(?:[46]#)?\w+#\w+#[\w.-]+$`)
+)
+
+// getIPSet returns the ipset for a node, inheriting the root setting
+func (c tree) getIPSet(node string) string {
+	if c.keyExists(node) && c[node].ipset != "" {
+		return c[node].ipset
+	}
+	if c.keyExists(rootNode) {
+		return c[rootNode].ipset
+	}
+	return ""
+}
+
+// getNFTSet returns the nftset for a node, inheriting the root setting
+func (c tree) getNFTSet(node string) string {
+	if c.keyExists(node) && c[node].nftset != "" {
+		return c[node].nftset
+	}
+	if c.keyExists(rootNode) {
+		return c[rootNode].nftset
+	}
+	return ""
+}
+
+// answersAAAA returns true if dnsmasq answers AAAA queries for blocked names, adding IPv6 addresses to their ipsets
+func answersAAAA(ip6, mode string) bool {
+	return ip6 != "" || mode == modeNone
+}
+
+// ipsetNames returns the ipsets in a comma separated list, each followed by its inet6 companion <name>6
+// when the source answers AAAA queries
+func ipsetNames(ipset, ip6, mode string) []string {
+	var names []string
+	for _, name := range strings.Split(ipset, ",") {
+		if name == "" {
+			continue
+		}
+		names = append(names, name)
+		if answersAAAA(ip6, mode) {
+			names = append(names, name+"6")
+		}
+	}
+	return names
+}
+
+// setLines returns the dnsmasq ipset= and nftset= formats for a source
+func setLines(s *source) []string {
+	var l []string
+	if names := ipsetNames(s.ipset, s.ip6, s.mode); len(names) > 0 {
+		l = append(l, "ipset=/%[1]v/"+strings.Join(names, ","))
+	}
+	if s.nftset != "" {
+		l = append(l, "nftset=/%[1]v/"+s.nftset)
+	}
+	return l
+}
+
+// checkSets returns an error if a node or source ipset or nftset is invalid or can't be used with its output
+func (c tree) checkSets() error {
+	for _, node := range []string{rootNode, domains, hosts} {
+		if !c.keyExists(node) {
+			continue
+		}
+
+		for _, s := range append([]*source{c[node]}, c[node].src...) {
+			ipset, nftset, mode, out := s.ipset, s.nftset, s.mode, s.output
+			if ipset == "" {
+				ipset = c.getIPSet(node)
+			}
+			if nftset == "" {
+				nftset = c.getNFTSet(node)
+			}
+			if mode == "" {
+				mode = c.getMode(node)
+			}
+			if out == "" {
+				out = c.getOutput(node)
+			}
+
+			for _, name := range strings.Split(ipset, ",") {
+				if ipset != "" && !ipsetName.MatchString(name) {
+					return fmt.Errorf("invalid %s %q for %s", ipsets, ipset, s.name)
+				}
+			}
+
+			for _, spec := range strings.Split(nftset, ",") {
+				if nftset != "" && !nftSpec.MatchString(spec) {
+					return fmt.Errorf("invalid %s %q for %s, expected [4|6#]family#table#set", nftsets, nftset, s.name)
+				}
+			}
+
+			switch {
+			case ipset == "" && nftset == "" && mode == modeNone:
+				return fmt.Errorf("%s %q for %s needs an %s or %s", blockMode, modeNone, s.name, ipsets, nftsets)
+			case ipset == "" && nftset == "":
+			case out == rpzOut, out == unboundOut:
+				return fmt.Errorf("%s and %s for %s need dnsmasq or hosts-file output", ipsets, nftsets, s.name)
+			}
+		}
+	}
+	return nil
+}
+
+// nftDefs returns the nft commands that create the table and set for an nftset spec
+func nftDefs(spec string) []string {
+	var (
+		addr = "ipv4_addr"
+		f    = strings.Split(spec, "#")
+	)
+
+	if len(f) == 4 {
+		if f[0] == "6" {
+			addr = "ipv6_addr"
+		}
+		f = f[1:]
+	}
+
+	return []string{
+		fmt.Sprintf("add table %s %s", f[0], f[1]),
+		fmt.Sprintf("add set %s %s %s { type %s; }", f[0], f[1], f[2], addr),
+	}
+}
+
+// WriteSets writes ipset and nft set definitions for every ipset and nftset in use when set-definitions is enabled
+func (c *Config) WriteSets() error {
+	if !c.tree.keyExists(rootNode) {
+		return nil
+	}
+	if ok, _ := strToBool(c.tree[rootNode].setDefs); !ok {
+		return nil
+	}
+
+	if c.DataDir == "" {
+		return fmt.Errorf("%s needs a data directory", setDefs)
+	}
+
+	var (
+		defs = map[string][]string{}
+		seen = make(map[string]bool)
+	)
+
+	add := func(file, def string) {
+		if !seen[def] {
+			seen[def] = true
+			defs[file] = append(defs[file], def)
+		}
+	}
+
+	for _, n := range c.sortKeys() {
+		for _, s := range append([]*source{c.tree[n]}, c.tree.validate(n).src...) {
+			ips, nfts, ip6, mode := s.ipset, s.nftset, s.ip6, s.mode
+			if s == c.tree[n] {
+				ips, nfts = c.tree.getIPSet(n), c.tree.getNFTSet(n)
+				ip6, mode = c.tree.getIP6(n), c.tree.getMode(n)
+			}
+
+			for _, name := range strings.Split(ips, ",") {
+				if name == "" {
+					continue
+				}
+				add(ipsetFile, fmt.Sprintf("create %s hash:ip -exist", name))
+				if answersAAAA(ip6, mode) {
+					add(ipsetFile, fmt.Sprintf("create %s6 hash:ip family inet6 -exist", name))
+				}
+			}
+
+			for _, spec := range strings.Split(nfts, ",") {
+				if spec != "" {
+					for _, d := range nftDefs(spec) {
+						add(nftFile, d)
+					}
+				}
+			}
+		}
+	}
+
+	if len(defs) < 1 {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.DataDir, 0o755); err != nil {
+		return err
+	}
+
+	for _, file := range []string{ipsetFile, nftFile} {
+		b := &bList{
+			file: filepath.Join(c.DataDir, file),
+			r:    strings.NewReader(strings.Join(defs[file], "\n") + "\n"),
+			size: len(defs[file]),
+		}
+		if err := b.writeFile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package edgeos
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSets(t *testing.T) {
+	Convey("Testing ipset and nftset output", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		newCfg := func(root, node string) (*Config, error) {
+			cfg := fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+    %s
+    domains {
+        %s
+        source ads {
+            url https://lists.example.com/ads.txt
+        }
+    }
+}`, root, node)
+			c := NewConfig(
+				DataDir(dir+"/data"),
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+			)
+			return c, c.Blacklist(&CFGstatic{Cfg: cfg})
+		}
+
+		render := func(c *Config) string {
+			s := c.Get(domains).Filter(urls).src[0]
+			s.Env = c.Env
+			s.r = strings.NewReader("ads.example.com\n")
+			c.ctr.stat[typeInt(s.nType)] = &stats{}
+			act, err := io.ReadAll(s.process().r)
+			So(err, ShouldBeNil)
+			return string(act)
+		}
+
+		tests := []struct {
+			exp  string
+			name string
+			node string
+			root string
+		}{
+			{
+				name: "an ipset",
+				root: "ipset blacklist",
+				exp:  "address=/ads.example.com/0.0.0.0\nipset=/ads.example.com/blacklist\n",
+			},
+			{
+				name: "an nftset inherited from the root",
+				root: "nftset 4#inet#filter#blacklist",
+				exp:  "address=/ads.example.com/0.0.0.0\nnftset=/ads.example.com/4#inet#filter#blacklist\n",
+			},
+			{
+				name: "a node ipset overriding the root",
+				root: "ipset blacklist",
+				node: "ipset ads4,ads6",
+				exp:  "address=/ads.example.com/0.0.0.0\nipset=/ads.example.com/ads4,ads6\n",
+			},
+			{
+				name: "blocking-mode none",
+				node: "blocking-mode none\n        ipset tagged",
+				exp:  "ipset=/ads.example.com/tagged,tagged6\n",
+			},
+			{
+				name: "an ipset and an IPv6 redirect",
+				root: "dns-redirect-ipv6 ::\n    ipset blacklist",
+				exp:  "address=/ads.example.com/0.0.0.0\naddress=/ads.example.com/::\nipset=/ads.example.com/blacklist,blacklist6\n",
+			},
+			{
+				name: "no sets",
+				exp:  "address=/ads.example.com/0.0.0.0\n",
+			},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				c, err := newCfg(tt.root, tt.node)
+				So(err, ShouldBeNil)
+				So(render(c), ShouldEqual, tt.exp)
+			})
+		}
+
+		Convey("with invalid settings", func() {
+			errs := []struct {
+				err  string
+				node string
+				root string
+			}{
+				{root: "ipset bad/name", err: `invalid ipset "bad/name" for blacklist`},
+				{root: "ipset " + strings.Repeat("b", 31), err: `invalid ipset "` + strings.Repeat("b", 31) + `" for blacklist`},
+				{node: "nftset filter", err: `invalid nftset "filter" for domains, expected [4|6#]family#table#set`},
+				{root: "blocking-mode none", err: `blocking-mode "none" for blacklist needs an ipset or nftset`},
+				{root: "output unbound", node: "ipset blacklist", err: `ipset and nftset for domains need dnsmasq or hosts-file output`},
+			}
+
+			for _, tt := range errs {
+				_, err := newCfg(tt.root, tt.node)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, tt.err)
+			}
+		})
+
+		Convey("with hosts-file output adding set lines after addn-hosts", func() {
+			c, err := newCfg("output hosts-file\n    ipset blacklist", "")
+			So(err, ShouldBeNil)
+			s := c.addInc(hosts)
+			s.Env = c.Env
+			s.r = strings.NewReader("ads.example.com\n")
+			c.ctr.stat[typeInt(s.nType)] = &stats{}
+
+			act, err := io.ReadAll(s.process().r)
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, "addn-hosts="+dir+"/data/hosts.blacklisted-servers.hosts\nipset=/ads.example.com/blacklist\n")
+		})
+
+		Convey("with set definitions written to the data directory", func() {
+			c, err := newCfg("set-definitions true\n    ipset blacklist\n    nftset 6#inet#filter#bl6", "nftset 4#ip#filter#bl4,6#inet#filter#bl6")
+			So(err, ShouldBeNil)
+			So(c.WriteSets(), ShouldBeNil)
+
+			b, err := ioutil.ReadFile(dir + "/data/" + ipsetFile)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "create blacklist hash:ip -exist\n")
+
+			b, err = ioutil.ReadFile(dir + "/data/" + nftFile)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "add table inet filter\nadd set inet filter bl6 { type ipv6_addr; }\nadd table ip filter\nadd set ip filter bl4 { type ipv4_addr; }\n")
+		})
+
+		Convey("with set definitions for a source with an IPv6 redirect", func() {
+			c, err := newCfg("set-definitions true\n    ipset blacklist", "dns-redirect-ipv6 ::")
+			So(err, ShouldBeNil)
+			So(c.WriteSets(), ShouldBeNil)
+
+			b, err := ioutil.ReadFile(dir + "/data/" + ipsetFile)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "create blacklist hash:ip -exist\ncreate blacklist6 hash:ip family inet6 -exist\n")
+		})
+
+		Convey("with set definitions disabled", func() {
+			c, err := newCfg("ipset blacklist", "")
+			So(err, ShouldBeNil)
+			So(c.WriteSets(), ShouldBeNil)
+			_, err = os.Stat(dir + "/data/" + ipsetFile)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
@@ -17,20 +17,42 @@ import (
 type source struct {
 	*Env
 	Objects
-	desc     string
-	disabled bool
-	err      error
-	exc      []string
-	file     string
-	inc      []string
-	ip       string
-	iface    IFace
-	ltype    string
-	nType    ntype
-	name     string
-	prefix   string
-	r        io.Reader
-	url      string
+	agent      string
+	desc       string
+	disabled   bool
+	err        error
+	exc        []string
+	file       string
+	headers    []string
+	inc        []string
+	ip         string
+	ip6        string
+	iface      IFace
+	layout     string
+	entries    int
+	ipset      string
+	kept       *list
+	ltype      string
+	mirror     []string
+	mirrorMode string
+	mode       string
+	nType      ntype
+	name       string
+	nftset     string
+	output     string
+	pass       string
+	prefix     string
+	probe      probeOpts
+	r          io.Reader
+	resolver   resolverOpts
+	served     string
+	setDefs    string
+	shards     string
+	tls        tlsOpts
+	token      string
+	url        string
+	user       string
+	written    bool
 }
 
 func (s *source) addSource(srcName [][]byte, n string) {
@@ -57,15 +79,21 @@ func (s *source) excludes() io.Reader {
 }
 
 func (s *source) filename(area string) string {
+	dir := s.outputDir(s.output)
 	switch s.nType {
 	case excRoot, preRoot:
-		return fmt.Sprintf(s.FnFmt, s.Dir, roots, s.name, s.Ext)
+		return fmt.Sprintf(s.FnFmt, dir, roots, s.name, s.Ext)
 	case excDomn, preDomn:
-		return fmt.Sprintf(s.FnFmt, s.Dir, domains, s.name, s.Ext)
+		return fmt.Sprintf(s.FnFmt, dir, domains, s.name, s.Ext)
 	case excHost, preHost:
-		return fmt.Sprintf(s.FnFmt, s.Dir, hosts, s.name, s.Ext)
+		return fmt.Sprintf(s.FnFmt, dir, hosts, s.name, s.Ext)
 	}
-	return fmt.Sprintf(s.FnFmt, s.Dir, area, s.name, s.Ext)
+	return fmt.Sprintf(s.FnFmt, dir, area, s.name, s.Ext)
+}
+
+// locations returns the source url followed by its mirrors in the order they are tried
+func (s *source) locations() []string {
+	return append([]string{s.url}, s.mirror...)
 }
 
 // includes returns an io.Reader of blacklist includes
@@ -159,12 +187,16 @@ func (s *source) process() *bList {
 	}
 
 	s.sum(area, dropped, extracted, kept)
+	s.kept = &l
 
-	return &bList{
-		file: s.filename(area),
-		r:    formatData(getDnsmasqPrefix(s), &l),
-		size: kept,
-	}
+	return s.newBList(area, &l, kept)
+}
+
+// release records how many entries a source kept and drops them once they've been written
+func (s *source) release() {
+	s.entries = len(s.kept.entry)
+	s.kept = nil
+	s.written = true
 }
 
 // Stringer for *source
@@ -203,8 +235,20 @@ func (s *source) sum(area string, dropped, extracted, kept int) {
 	atomic.AddInt32(&ctr[area].extracted, int32(extracted))
 	atomic.AddInt32(&ctr[area].kept, int32(kept))
 
+	if s.served != "" && s.served != s.url {
+		s.ctr.Lock()
+		if s.ctr.mirrors == nil {
+			s.ctr.mirrors = make(map[string]string)
+		}
+		s.ctr.mirrors[s.name] = s.served
+		s.ctr.Unlock()
+	}
+
 	switch {
 	case kept > 0:
+		if s.served != "" && s.served != s.url {
+			s.Log.Infof("%s: served by: %s", s.name, s.served)
+		}
 		s.Log.Infof("%s: downloaded: %d", s.name, extracted)
 		s.Log.Infof("%s: extracted: %d", s.name, kept)
 		s.Log.Infof("%s: dropped: %d", s.name, dropped)
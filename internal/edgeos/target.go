@@ -0,0 +1,203 @@
+package edgeos
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+const (
+	targets      = "target"
+	targetDir    = "directory"
+	targetNode   = "node"
+	targetPid    = "pid-file"
+	targetReload = "reload-command"
+)
+
+var targetName = regexp.MustCompile(`^\w[\w.-]*$`)
+
+// target is a dnsmasq instance with its own conf-dir, reload command, PID file and blacklist sources
+type target struct {
+	name    string
+	dir     string
+	pidFile string
+	reload  string
+	nodes   []string
+	sources []string
+}
+
+// label sets a target option
+func (t *target) label(name [][]byte) {
+	v := string(name[2])
+	switch string(name[1]) {
+	case targetDir:
+		t.dir = v
+	case targetNode:
+		t.nodes = append(t.nodes, v)
+	case targetPid:
+		t.pidFile = v
+	case targetReload:
+		t.reload = v
+	case src:
+		t.sources = append(t.sources, v)
+	}
+}
+
+// has reports whether name is in a target's list of nodes or sources
+func has(list []string, name string) bool {
+	for _, l := range list {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTargets returns an error if a target is incomplete, can't be reloaded, shares a directory or names an unknown node or source
+func (c *Config) checkTargets() error {
+	dirs := make(map[string]string)
+	for _, t := range c.targets {
+		if !targetName.MatchString(t.name) {
+			return fmt.Errorf("invalid %s name %q", targets, t.name)
+		}
+
+		if t.dir == "" {
+			return fmt.Errorf("%s %s needs a %s", targets, t.name, targetDir)
+		}
+
+		if t.reload == "" && t.pidFile == "" {
+			return fmt.Errorf("%s %s needs a %s or a %s", targets, t.name, targetReload, targetPid)
+		}
+
+		dir := filepath.Clean(t.dir)
+		if other, ok := dirs[dir]; ok {
+			return fmt.Errorf("%ss %s and %s share %s %s", targets, other, t.name, targetDir, t.dir)
+		}
+		dirs[dir] = t.name
+
+		if len(t.nodes)+len(t.sources) < 1 {
+			return fmt.Errorf("%s %s has no nodes or sources", targets, t.name)
+		}
+
+		for _, n := range t.nodes {
+			if n != domains && n != hosts {
+				return fmt.Errorf("invalid %s %q for %s %s, must be %s or %s", targetNode, n, targets, t.name, domains, hosts)
+			}
+		}
+
+	next:
+		for _, name := range t.sources {
+			for _, node := range []string{domains, hosts} {
+				if !c.tree.keyExists(node) {
+					continue
+				}
+				for _, s := range c.tree[node].src {
+					if s.name == name {
+						continue next
+					}
+				}
+			}
+			return fmt.Errorf("%s %s includes unknown %s %q", targets, t.name, src, name)
+		}
+	}
+	return nil
+}
+
+// subset returns a copy of the tree holding only the nodes and sources a target gets;
+// root settings, includes and excludes always apply
+func (c tree) subset(t *target) tree {
+	sub := make(tree)
+	if c.keyExists(rootNode) {
+		root := *c[rootNode]
+		sub[rootNode] = &root
+	}
+
+	for _, node := range []string{domains, hosts} {
+		if !c.keyExists(node) {
+			continue
+		}
+
+		n := *c[node]
+		n.src = nil
+		whole := has(t.nodes, node)
+		for _, s := range c[node].src {
+			if whole || has(t.sources, s.name) {
+				cp := *s
+				n.src = append(n.src, &cp)
+			}
+		}
+
+		if whole || len(n.src) > 0 {
+			sub[node] = &n
+		}
+	}
+	return sub
+}
+
+// Targets returns a Config for each configured target, writing to the target's directory and
+// reloading it with the target's own command or pid-file, never the global dnsmasq service;
+// without targets it returns c itself
+func (c *Config) Targets() []*Config {
+	if len(c.targets) < 1 {
+		return []*Config{c}
+	}
+
+	var cs []*Config
+	for _, t := range c.targets {
+		env := *c.Env
+		env.ctr = ctr{RWMutex: &sync.RWMutex{}, stat: make(stat)}
+		env.Dex = &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+		env.Exc = &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+		env.Dir = t.dir
+		env.PidFile = t.pidFile
+		env.DNSsvc = t.reload
+		env.ReloadCmd = t.reload
+		env.Target = t.name
+
+		if env.DataDir != "" {
+			env.DataDir = filepath.Join(env.DataDir, t.name)
+		}
+		if env.OutDir != "" {
+			env.OutDir = filepath.Join(env.OutDir, t.name)
+		}
+		if env.GenDir != "" {
+			env.GenDir = filepath.Join(env.GenDir, t.name)
+		}
+
+		cs = append(cs, &Config{Env: &env, tree: c.tree.subset(t)})
+	}
+	return cs
+}
+
+// PurgeUntargeted removes the blacklist files left in the global directories once targets are configured,
+// unless a target writes to one of them, and returns the files removed
+func (c *Config) PurgeUntargeted() ([]string, error) {
+	if len(c.targets) < 1 {
+		return nil, nil
+	}
+
+	used := make(map[string]bool)
+	for _, t := range c.targets {
+		used[filepath.Clean(t.dir)] = true
+	}
+
+	var stale []string
+	for dir, globs := range c.stageGlobs() {
+		if used[filepath.Clean(dir)] {
+			continue
+		}
+
+		for _, g := range globs {
+			files, err := filepath.Glob(g)
+			if err != nil {
+				return nil, err
+			}
+			stale = append(stale, files...)
+		}
+	}
+
+	sort.Strings(stale)
+	return stale, purgeFiles(stale)
+}
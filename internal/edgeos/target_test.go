@@ -0,0 +1,184 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTargets(t *testing.T) {
+	Convey("Testing dnsmasq instance targets", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		for f, data := range map[string]string{
+			"ads.txt":     "ads.example.com\n",
+			"malware.txt": "malware.example.com\n",
+		} {
+			So(ioutil.WriteFile(filepath.Join(dir, f), []byte(data), 0o644), ShouldBeNil)
+		}
+
+		var (
+			guest = filepath.Join(dir, "guest.d")
+			staff = filepath.Join(dir, "staff.d")
+		)
+
+		// load parses a configuration with the given targets
+		load := func(targets string) (*Config, error) {
+			c := NewConfig(
+				DataDir(filepath.Join(dir, "hosts")),
+				Dir(filepath.Join(dir, "dnsmasq.d")),
+				DNSsvc("/bin/systemctl restart dnsmasq"),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				GenDir(filepath.Join(dir, "generations")),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+				WCard(Wildcard{Node: "*s", Name: "*"}),
+			)
+			return c, c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        include tracker.example.com
+        source ads {
+            file %[1]s/ads.txt
+        }
+        source malware {
+            file %[1]s/malware.txt
+        }
+    }
+%[2]s}`, dir, targets)})
+		}
+
+		Convey("without targets", func() {
+			c, err := load("")
+			So(err, ShouldBeNil)
+			So(c.Targets(), ShouldResemble, []*Config{c})
+
+			stale, err := c.PurgeUntargeted()
+			So(err, ShouldBeNil)
+			So(stale, ShouldBeEmpty)
+		})
+
+		Convey("with a guest and a staff target", func() {
+			c, err := load(fmt.Sprintf(`    target guest {
+        directory %s
+        node domains
+        pid-file /var/run/dnsmasq/dnsmasq-guest.pid
+        reload-command "/bin/systemctl restart dnsmasq@guest"
+    }
+    target staff {
+        directory %s
+        pid-file /var/run/dnsmasq/dnsmasq-staff.pid
+        source malware
+    }
+`, guest, staff))
+			So(err, ShouldBeNil)
+
+			ts := c.Targets()
+			So(len(ts), ShouldEqual, 2)
+
+			So(ts[0].Target, ShouldEqual, "guest")
+			So(ts[0].Dir, ShouldEqual, guest)
+			So(ts[0].DNSsvc, ShouldEqual, "/bin/systemctl restart dnsmasq@guest")
+			So(ts[0].ReloadCmd, ShouldEqual, "/bin/systemctl restart dnsmasq@guest")
+			So(ts[0].PidFile, ShouldEqual, "/var/run/dnsmasq/dnsmasq-guest.pid")
+			So(ts[0].DataDir, ShouldEqual, filepath.Join(dir, "hosts", "guest"))
+			So(ts[0].GenDir, ShouldEqual, filepath.Join(dir, "generations", "guest"))
+
+			So(ts[1].Target, ShouldEqual, "staff")
+			So(ts[1].DNSsvc, ShouldBeEmpty)
+			So(ts[1].ReloadCmd, ShouldBeEmpty)
+			So(ts[1].PidFile, ShouldEqual, "/var/run/dnsmasq/dnsmasq-staff.pid")
+			So(c.Dir, ShouldEqual, filepath.Join(dir, "dnsmasq.d"))
+
+			for _, t := range ts {
+				So(os.MkdirAll(t.Dir, 0o755), ShouldBeNil)
+				for _, o := range []IFace{PreDObj, FileObj} {
+					ct, err := t.NewContent(o)
+					So(err, ShouldBeNil)
+					So(t.ProcessContent(ct), ShouldBeNil)
+				}
+			}
+
+			files := func(d string) []string {
+				f, err := filepath.Glob(filepath.Join(d, "*"))
+				So(err, ShouldBeNil)
+				for i := range f {
+					f[i] = filepath.Base(f[i])
+				}
+				return f
+			}
+
+			So(files(guest), ShouldResemble, []string{
+				"domains.ads.blacklist.conf",
+				"domains.blacklisted-subdomains.blacklist.conf",
+				"domains.malware.blacklist.conf",
+			})
+			So(files(staff), ShouldResemble, []string{
+				"domains.blacklisted-subdomains.blacklist.conf",
+				"domains.malware.blacklist.conf",
+			})
+
+			So(ts[1].GetAll().Files().Strings(), ShouldResemble, []string{
+				filepath.Join(staff, "domains.blacklisted-subdomains.blacklist.conf"),
+				filepath.Join(staff, "domains.malware.blacklist.conf"),
+				filepath.Join(staff, "roots.global-blacklisted-domains.blacklist.conf"),
+			})
+
+			Convey("purging the files left in the global directories", func() {
+				global := filepath.Join(dir, "dnsmasq.d")
+				So(os.MkdirAll(global, 0o755), ShouldBeNil)
+				So(os.MkdirAll(c.DataDir, 0o755), ShouldBeNil)
+				for _, f := range []string{
+					filepath.Join(global, "domains.ads.blacklist.conf"),
+					filepath.Join(global, "dnsmasq.conf"),
+					filepath.Join(c.DataDir, "hosts.local.hosts"),
+				} {
+					So(ioutil.WriteFile(f, []byte("old\n"), 0o644), ShouldBeNil)
+				}
+
+				stale, err := c.PurgeUntargeted()
+				So(err, ShouldBeNil)
+				So(stale, ShouldResemble, []string{
+					filepath.Join(global, "domains.ads.blacklist.conf"),
+					filepath.Join(c.DataDir, "hosts.local.hosts"),
+				})
+				So(files(global), ShouldResemble, []string{"dnsmasq.conf"})
+				So(len(files(guest)), ShouldEqual, 3)
+
+				stale, err = c.PurgeUntargeted()
+				So(err, ShouldBeNil)
+				So(stale, ShouldBeEmpty)
+			})
+		})
+
+		Convey("with invalid targets", func() {
+			tests := []struct {
+				cfg string
+				exp string
+			}{
+				{cfg: "target guest {\nnode domains\n}\n", exp: "target guest needs a directory"},
+				{cfg: fmt.Sprintf("target guest {\ndirectory %s\nnode domains\n}\n", guest), exp: "target guest needs a reload-command or a pid-file"},
+				{cfg: fmt.Sprintf("target guest {\ndirectory %s\npid-file /run/guest.pid\n}\n", guest), exp: "target guest has no nodes or sources"},
+				{
+					cfg: fmt.Sprintf("target guest {\ndirectory %s\npid-file /run/guest.pid\nnode domains\n}\ntarget staff {\ndirectory %s/\npid-file /run/staff.pid\nnode domains\n}\n", guest, guest),
+					exp: fmt.Sprintf("targets guest and staff share directory %s/", guest),
+				},
+				{cfg: fmt.Sprintf("target guest {\ndirectory %s\npid-file /run/guest.pid\nnode roots\n}\n", guest), exp: `invalid node "roots" for target guest, must be domains or hosts`},
+				{cfg: fmt.Sprintf("target guest {\ndirectory %s\npid-file /run/guest.pid\nsource spam\n}\n", guest), exp: `target guest includes unknown source "spam"`},
+			}
+
+			for _, tt := range tests {
+				_, err := load(tt.cfg)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, tt.exp)
+			}
+		})
+	})
+}
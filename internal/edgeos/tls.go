@@ -0,0 +1,158 @@
+package edgeos
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	caFile   = "ca-file"
+	insecure = "insecure-skip-verify"
+	spkiPin  = "pin-sha256"
+	tlsMin   = "tls-min-version"
+)
+
+// errPinMismatch is returned when no certificate in a server's chain matches the configured SPKI pin
+var errPinMismatch = errors.New("server certificate public key does not match pin-sha256")
+
+// tlsOpts holds the TLS trust settings for a source or top node
+type tlsOpts struct {
+	ca       string
+	insecure string
+	minVer   string
+	pin      string
+}
+
+// inherit fills in unset TLS settings from p
+func (t tlsOpts) inherit(p tlsOpts) tlsOpts {
+	if t.ca == "" {
+		t.ca = p.ca
+	}
+	if t.insecure == "" {
+		t.insecure = p.insecure
+	}
+	if t.minVer == "" {
+		t.minVer = p.minVer
+	}
+	if t.pin == "" {
+		t.pin = p.pin
+	}
+	return t
+}
+
+// set assigns a TLS setting from a configuration leaf
+func (t *tlsOpts) set(k, v string) {
+	switch k {
+	case caFile:
+		t.ca = v
+	case insecure:
+		t.insecure = v
+	case spkiPin:
+		t.pin = v
+	case tlsMin:
+		t.minVer = v
+	}
+}
+
+// isTLSErr returns true if err was caused by a TLS handshake or certificate verification failure
+func isTLSErr(err error) bool {
+	var (
+		certErr     *tls.CertificateVerificationError
+		hostErr     x509.HostnameError
+		invalidErr  x509.CertificateInvalidError
+		recordErr   tls.RecordHeaderError
+		unknownAuth x509.UnknownAuthorityError
+	)
+
+	switch {
+	case errors.Is(err, errPinMismatch),
+		errors.As(err, &certErr),
+		errors.As(err, &hostErr),
+		errors.As(err, &invalidErr),
+		errors.As(err, &recordErr),
+		errors.As(err, &unknownAuth):
+		return true
+	}
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+// spki returns the base64 encoded SHA-256 hash of a certificate's SubjectPublicKeyInfo
+func spki(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// tlsVersion converts a tls-min-version value to its crypto/tls constant
+func tlsVersion(v string) (uint16, error) {
+	switch v {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid %s %q, must be one of 1.0, 1.1, 1.2 or 1.3", tlsMin, v)
+}
+
+// tlsConfig returns a *tls.Config built from the source's TLS settings
+func (s *source) tlsConfig() (*tls.Config, error) {
+	var (
+		cfg = &tls.Config{}
+		err error
+	)
+
+	if cfg.MinVersion, err = tlsVersion(s.tls.minVer); err != nil {
+		return nil, err
+	}
+
+	if s.tls.ca != "" {
+		if cfg.RootCAs, err = x509.SystemCertPool(); err != nil {
+			cfg.RootCAs = x509.NewCertPool()
+		}
+
+		// nolint
+		pem, err := os.ReadFile(s.tls.ca)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s for source %s: %v", caFile, s.name, err)
+		}
+
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s %s for source %s", caFile, s.tls.ca, s.name)
+		}
+	}
+
+	if s.tls.insecure != "" {
+		if cfg.InsecureSkipVerify, err = strToBool(s.tls.insecure); err != nil {
+			return nil, fmt.Errorf("invalid %s %q for source %s", insecure, s.tls.insecure, s.name)
+		}
+	}
+
+	if cfg.InsecureSkipVerify {
+		s.Log.Warningf("%s: TLS certificate verification is DISABLED by %s - use for lab testing only!", s.name, insecure)
+	}
+
+	if s.tls.pin != "" {
+		pin := strings.TrimPrefix(s.tls.pin, "sha256//")
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, cert := range cs.PeerCertificates {
+				if spki(cert) == pin {
+					return nil
+				}
+			}
+			return errPinMismatch
+		}
+	}
+
+	return cfg, nil
+}
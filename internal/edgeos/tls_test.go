@@ -0,0 +1,119 @@
+package edgeos
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTLSDownload(t *testing.T) {
+	Convey("Testing download() with TLS options", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "secure.example.com")
+			},
+		))
+		srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+		srv.StartTLS()
+		defer srv.Close()
+
+		cert := srv.Certificate()
+		ca := dir + "/ca.pem"
+		So(ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/empty.pem", []byte("garbage"), 0o644), ShouldBeNil)
+
+		tests := []struct {
+			err  string
+			exp  string
+			name string
+			tls  tlsOpts
+		}{
+			{name: "system roots only", tls: tlsOpts{}, err: "TLS failure for source secure"},
+			{name: "private CA bundle", tls: tlsOpts{ca: ca}, exp: "secure.example.com"},
+			{name: "matching pin", tls: tlsOpts{ca: ca, pin: "sha256//" + spki(cert)}, exp: "secure.example.com"},
+			{name: "mismatched pin", tls: tlsOpts{ca: ca, pin: "AAAA"}, err: "TLS failure for source secure"},
+			{name: "insecure-skip-verify", tls: tlsOpts{insecure: True}, exp: "secure.example.com"},
+			{name: "insecure-skip-verify with mismatched pin", tls: tlsOpts{insecure: True, pin: "AAAA"}, err: "TLS failure for source secure"},
+			{name: "minimum TLS version above server maximum", tls: tlsOpts{ca: ca, minVer: "1.3"}, err: "TLS failure for source secure"},
+			{name: "invalid minimum TLS version", tls: tlsOpts{minVer: "2.0"}, err: `invalid tls-min-version "2.0", must be one of 1.0, 1.1, 1.2 or 1.3`},
+			{name: "invalid insecure-skip-verify", tls: tlsOpts{insecure: "maybe"}, err: `invalid insecure-skip-verify "maybe" for source secure`},
+			{name: "missing CA bundle", tls: tlsOpts{ca: dir + "/missing.pem"}, err: "unable to read ca-file for source secure"},
+			{name: "CA bundle without certificates", tls: tlsOpts{ca: dir + "/empty.pem"}, err: "no PEM certificates found in ca-file"},
+		}
+
+		for _, tt := range tests {
+			Convey("with "+tt.name, func() {
+				o := download(&source{
+					Env:  &Env{Log: newLog(), Method: "GET"},
+					name: "secure",
+					tls:  tt.tls,
+					url:  srv.URL,
+				})
+
+				switch tt.err {
+				case "":
+					So(o.err, ShouldBeNil)
+				default:
+					So(o.err, ShouldNotBeNil)
+					So(strings.HasPrefix(o.err.Error(), tt.err), ShouldBeTrue)
+				}
+
+				act, err := io.ReadAll(o.r)
+				So(err, ShouldBeNil)
+				So(string(act), ShouldEqual, tt.exp)
+			})
+		}
+
+		Convey("with a pin mismatch reported as a TLS error", func() {
+			So(isTLSErr(fmt.Errorf("wrapped: %w", errPinMismatch)), ShouldBeTrue)
+			So(isTLSErr(errors.New("connection refused")), ShouldBeFalse)
+		})
+	})
+}
+
+func TestGetTLS(t *testing.T) {
+	Convey("Testing TLS option inheritance", t, func() {
+		cfg := `blacklist {
+    ca-file /config/auth/root.pem
+    dns-redirect-ip 0.0.0.0
+    tls-min-version 1.2
+    domains {
+        pin-sha256 sha256//node=
+        source private {
+            tls-min-version 1.3
+            url https://lists.example.com/domains.txt
+        }
+    }
+    hosts {
+        source lab {
+            insecure-skip-verify true
+            url https://lab.example.com/hosts.txt
+        }
+    }
+}`
+		c := NewConfig()
+		So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+
+		d := c.Get(domains).Filter(urls).src[0]
+		So(d.tls, ShouldResemble, tlsOpts{ca: "/config/auth/root.pem", minVer: "1.3", pin: "sha256//node="})
+
+		h := c.Get(hosts).Filter(urls).src[0]
+		So(h.tls, ShouldResemble, tlsOpts{ca: "/config/auth/root.pem", insecure: True, minVer: "1.2"})
+
+		So(make(tree).getTLS(domains), ShouldResemble, tlsOpts{})
+	})
+}
@@ -0,0 +1,238 @@
+package edgeos
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stagePattern names the temporary directory an update is staged in; dnsmasq skips dot files in its conf-dir
+const stagePattern = ".blacklist.staging-*"
+
+// liveDir returns the dnsmasq configuration directory, even while an update is staged
+func (e *Env) liveDir() string {
+	if e.live != nil {
+		return e.live[0]
+	}
+	return e.Dir
+}
+
+// liveName returns the live file a staged file replaces, or file itself if it isn't staged
+func liveName(file string) string {
+	dir := filepath.Dir(file)
+	if ok, _ := filepath.Match(stagePattern, filepath.Base(dir)); ok {
+		return filepath.Join(filepath.Dir(dir), filepath.Base(file))
+	}
+	return file
+}
+
+// stageDirs returns the directories an update writes to: dnsmasq's Dir, the addn-hosts and set DataDir
+// and the Unbound and RPZ OutDir
+func (e *Env) stageDirs() []*string {
+	return []*string{&e.Dir, &e.DataDir, &e.OutDir}
+}
+
+// stageGlobs returns the patterns of the files a committed update replaces in each live directory
+func (e *Env) stageGlobs() map[string][]string {
+	var (
+		live  = e.live
+		globs = make(map[string][]string)
+	)
+	if live == nil {
+		live = []string{e.Dir, e.DataDir, e.OutDir}
+	}
+
+	add := func(dir string, patterns ...string) {
+		if dir != "" {
+			globs[dir] = append(globs[dir], patterns...)
+		}
+	}
+
+	add(live[0], fmt.Sprintf(e.FnFmt, live[0], e.Wildcard.Node, e.Wildcard.Name, e.Ext))
+	add(live[1], dataGlobs(live[1])...)
+	add(live[2], fmt.Sprintf(e.FnFmt, live[2], e.Wildcard.Node, e.Wildcard.Name, e.Ext), filepath.Join(live[2], rpzFile))
+	return globs
+}
+
+// dataGlobs returns the patterns of the addn-hosts and set files generated in a data directory
+func dataGlobs(dir string) []string {
+	return []string{filepath.Join(dir, "*.hosts"), filepath.Join(dir, ipsetFile), filepath.Join(dir, nftFile)}
+}
+
+// Begin stages every file written by the update in a temporary directory within Dir, DataDir and OutDir
+// until Commit swaps them in or Rollback discards them
+func (c *Config) Begin() error {
+	if c.live != nil {
+		return errors.New("a blacklist update is already staged")
+	}
+
+	var (
+		live   []string
+		stages = make(map[string]string)
+	)
+
+	for _, d := range c.stageDirs() {
+		live = append(live, *d)
+		if *d == "" {
+			continue
+		}
+
+		stage, ok := stages[*d]
+		if !ok {
+			if err := os.MkdirAll(*d, 0o755); err != nil {
+				removeStages(stages)
+				return err
+			}
+
+			var err error
+			if stage, err = os.MkdirTemp(*d, stagePattern); err != nil {
+				removeStages(stages)
+				return fmt.Errorf("unable to stage blacklist update: %v", err)
+			}
+			stages[*d] = stage
+		}
+		*d = stage
+	}
+
+	c.live = live
+	return nil
+}
+
+// removeStages removes the staging directories created so far
+func removeStages(stages map[string]string) {
+	for _, stage := range stages {
+		os.RemoveAll(stage)
+	}
+}
+
+// unstage points Dir, DataDir and OutDir back at the live directories and returns each live directory's stage
+func (c *Config) unstage() map[string]string {
+	stages := make(map[string]string)
+	for i, d := range c.stageDirs() {
+		if c.live[i] != "" {
+			stages[c.live[i]] = *d
+		}
+		*d = c.live[i]
+	}
+	c.live = nil
+	return stages
+}
+
+// Commit renames the staged files into their live directories and removes the blacklist files they replace,
+// so the staged set becomes the live set
+func (c *Config) Commit() error {
+	if c.live == nil {
+		return errors.New("no blacklist update is staged")
+	}
+
+	var (
+		globs  = c.stageGlobs()
+		stages = c.unstage()
+		dirs   = make([]string, 0, len(stages))
+	)
+	defer removeStages(stages)
+
+	for dir := range stages {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		if err := commitDir(stages[dir], dir, globs[dir]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitDir renames the files staged in stage into dir and removes the files matching globs they don't replace
+func commitDir(stage, dir string, globs []string) error {
+	staged, err := filepath.Glob(filepath.Join(stage, "*"))
+	if err != nil {
+		return err
+	}
+
+	if err = syncDir(stage); err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(staged))
+	for _, f := range staged {
+		live := filepath.Join(dir, filepath.Base(f))
+		if err = os.Rename(f, live); err != nil {
+			return fmt.Errorf("unable to commit %s: %v", live, err)
+		}
+		keep[live] = true
+	}
+
+	if err = syncDir(dir); err != nil {
+		return err
+	}
+
+	var stale []string
+	for _, g := range globs {
+		files, err := filepath.Glob(g)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if !keep[f] {
+				stale = append(stale, f)
+			}
+		}
+	}
+	return purgeFiles(stale)
+}
+
+// Rollback discards a staged update, leaving the live files untouched
+func (c *Config) Rollback() error {
+	if c.live == nil {
+		return nil
+	}
+
+	var errs []string
+	for _, stage := range c.unstage() {
+		if err := os.RemoveAll(stage); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if errs != nil {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// keepLive links a source's live files into the staged update, so a source that couldn't be fetched keeps
+// its previous entries rather than being purged by Commit
+func (s *source) keepLive(area string) error {
+	files := []string{s.filename(area)}
+	if s.addnHosts() {
+		files = append(files, s.hostsFile())
+	}
+
+	for _, f := range files {
+		live := liveName(f)
+		if live == f {
+			continue
+		}
+		if err := os.Link(live, f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncDir flushes a directory's entries to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,208 @@
+package edgeos
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTransaction(t *testing.T) {
+	Convey("Testing staged blacklist updates", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(filepath.Join(dir, "ads.txt"), []byte("ads.example.com\n"), 0o644), ShouldBeNil)
+		for f, data := range map[string]string{
+			"domains.ads.blacklist.conf":   "address=/old.example.com/0.0.0.0\n",
+			"domains.stale.blacklist.conf": "address=/stale.example.com/0.0.0.0\n",
+			"dnsmasq.conf":                 "conf-dir=.\n",
+		} {
+			So(ioutil.WriteFile(filepath.Join(dir, f), []byte(data), 0o644), ShouldBeNil)
+		}
+
+		config := func() *Config {
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				OutDir(filepath.Join(dir, "blacklist.out")),
+				Prefix("address=", "server="),
+				WCard(Wildcard{Node: "*s", Name: "*"}),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        source ads {
+            file %s/ads.txt
+        }
+    }
+}`, dir)}), ShouldBeNil)
+			return c
+		}
+		c := config()
+
+		read := func(f string) string {
+			b, err := ioutil.ReadFile(filepath.Join(dir, f))
+			So(err, ShouldBeNil)
+			return string(b)
+		}
+
+		exists := func(f string) bool {
+			_, err := os.Stat(filepath.Join(dir, f))
+			return err == nil
+		}
+
+		stage := func() {
+			So(c.Begin(), ShouldBeNil)
+			So(c.Dir, ShouldNotEqual, dir)
+			So(c.liveDir(), ShouldEqual, dir)
+
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+
+			So(read("domains.ads.blacklist.conf"), ShouldEqual, "address=/old.example.com/0.0.0.0\n")
+		}
+
+		Convey("with a committed update", func() {
+			stage()
+			So(c.Commit(), ShouldBeNil)
+			So(c.Dir, ShouldEqual, dir)
+
+			So(read("domains.ads.blacklist.conf"), ShouldEqual, "address=/ads.example.com/0.0.0.0\n")
+			So(exists("domains.stale.blacklist.conf"), ShouldBeFalse)
+			So(exists("dnsmasq.conf"), ShouldBeTrue)
+
+			staged, err := filepath.Glob(filepath.Join(dir, stagePattern))
+			So(err, ShouldBeNil)
+			So(staged, ShouldBeEmpty)
+		})
+
+		Convey("with an update that changes nothing", func() {
+			stage()
+			So(c.Commit(), ShouldBeNil)
+			before, err := os.Stat(filepath.Join(dir, "domains.ads.blacklist.conf"))
+			So(err, ShouldBeNil)
+
+			c = config()
+			So(c.Begin(), ShouldBeNil)
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			So(c.Commit(), ShouldBeNil)
+
+			after, err := os.Stat(filepath.Join(dir, "domains.ads.blacklist.conf"))
+			So(err, ShouldBeNil)
+			So(os.SameFile(before, after), ShouldBeTrue)
+			So(read("domains.ads.blacklist.conf"), ShouldEqual, "address=/ads.example.com/0.0.0.0\n")
+		})
+
+		Convey("with a rolled back update", func() {
+			stage()
+			So(c.Rollback(), ShouldBeNil)
+			So(c.Dir, ShouldEqual, dir)
+
+			So(read("domains.ads.blacklist.conf"), ShouldEqual, "address=/old.example.com/0.0.0.0\n")
+			So(exists("domains.stale.blacklist.conf"), ShouldBeTrue)
+
+			staged, err := filepath.Glob(filepath.Join(dir, stagePattern))
+			So(err, ShouldBeNil)
+			So(staged, ShouldBeEmpty)
+		})
+
+		Convey("with an RPZ master zone including the live files", func() {
+			c.tree[domains].output = rpzOut
+			c.tree.validate(domains)
+			stage()
+			So(c.WriteRPZ(), ShouldBeNil)
+			So(c.Commit(), ShouldBeNil)
+
+			So(exists(rpzFile), ShouldBeFalse)
+			So(read("blacklist.out/"+rpzFile), ShouldContainSubstring, "$INCLUDE "+dir+"/blacklist.out/domains.ads.blacklist.conf\n")
+		})
+
+		Convey("with a source that can't be fetched", func() {
+			So(os.Remove(filepath.Join(dir, "ads.txt")), ShouldBeNil)
+			So(c.Begin(), ShouldBeNil)
+
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+
+			var serr *SourceError
+			So(errors.As(c.ProcessContent(ct), &serr), ShouldBeTrue)
+			So(c.Commit(), ShouldBeNil)
+
+			So(read("domains.ads.blacklist.conf"), ShouldEqual, "address=/old.example.com/0.0.0.0\n")
+			So(exists("domains.stale.blacklist.conf"), ShouldBeFalse)
+		})
+
+		Convey("with addn-hosts and set files staged in the data directory", func() {
+			data := filepath.Join(dir, "blacklist.hosts")
+			So(os.MkdirAll(data, 0o755), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(data, "hosts.stale.hosts"), []byte("0.0.0.0 stale.example.com\n"), 0o644), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, "hosts.txt"), []byte("tracker.example.com\n"), 0o644), ShouldBeNil)
+
+			c := NewConfig(
+				DataDir(data),
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+				WCard(Wildcard{Node: "*s", Name: "*"}),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+    ipset blacklist
+    set-definitions true
+    hosts {
+        output hosts-file
+        source tracking {
+            file %s/hosts.txt
+        }
+    }
+}`, dir)}), ShouldBeNil)
+
+			So(c.Begin(), ShouldBeNil)
+			So(c.DataDir, ShouldNotEqual, data)
+
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			So(c.WriteSets(), ShouldBeNil)
+
+			So(exists("blacklist.hosts/hosts.tracking.hosts"), ShouldBeFalse)
+			So(exists("blacklist.hosts/"+ipsetFile), ShouldBeFalse)
+
+			So(c.Commit(), ShouldBeNil)
+			So(c.DataDir, ShouldEqual, data)
+
+			So(read("hosts.tracking.blacklist.conf"), ShouldStartWith, "addn-hosts="+data+"/hosts.tracking.hosts\n")
+			So(read("blacklist.hosts/hosts.tracking.hosts"), ShouldEqual, "0.0.0.0 tracker.example.com\n")
+			So(exists("blacklist.hosts/"+ipsetFile), ShouldBeTrue)
+			So(exists("blacklist.hosts/hosts.stale.hosts"), ShouldBeFalse)
+
+			staged, err := filepath.Glob(filepath.Join(data, stagePattern))
+			So(err, ShouldBeNil)
+			So(staged, ShouldBeEmpty)
+		})
+
+		Convey("with an update already staged", func() {
+			stage()
+			So(c.Begin(), ShouldNotBeNil)
+			So(c.Rollback(), ShouldBeNil)
+		})
+
+		Convey("with nothing staged", func() {
+			So(c.Commit(), ShouldNotBeNil)
+			So(c.Rollback(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,104 @@
+package edgeos
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dnsTestLine matches the line and file dnsmasq reports for a bad option
+var dnsTestLine = regexp.MustCompile(`line (\d+) of (\S+)`)
+
+// dnsmasqFiles returns the blacklist files in Dir that dnsmasq reads
+func (c *Config) dnsmasqFiles() ([]string, error) {
+	return filepath.Glob(fmt.Sprintf(c.FnFmt, c.Dir, c.Wildcard.Node, c.Wildcard.Name, c.Ext))
+}
+
+// Validate runs the DNStest command against the dnsmasq files in Dir, normally a staged update,
+// and returns an error naming the offending file and line if dnsmasq rejects them
+func (c *Config) Validate() error {
+	args := strings.Fields(c.DNStest)
+	if len(args) < 1 {
+		return nil
+	}
+
+	if _, err := exec.LookPath(args[0]); err != nil {
+		c.Log.Warningf("%s not found, skipping dnsmasq configuration test", args[0])
+		return nil
+	}
+
+	files, err := c.dnsmasqFiles()
+	if err != nil || len(files) < 1 {
+		return err
+	}
+
+	var conf strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&conf, "conf-file=%s\n", f)
+	}
+
+	out, err := runDNStest(args, conf.String())
+	if err == nil {
+		return nil
+	}
+	return c.testError(out, err)
+}
+
+// runDNStest runs the DNStest command args against a temporary configuration file holding conf
+func runDNStest(args []string, conf string) (string, error) {
+	f, err := os.CreateTemp("", "blacklist.test-*.conf")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.WriteString(conf); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err = f.Close(); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(args[0], append(args[1:], "--conf-file="+f.Name())...) // nolint
+	cmd.Stdin = strings.NewReader("")
+	out, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+// testError returns an error describing why dnsmasq rejected a file, quoting the offending line
+func (c *Config) testError(out string, err error) error {
+	m := dnsTestLine.FindStringSubmatch(out)
+	if m == nil {
+		return fmt.Errorf("dnsmasq configuration test failed: %v: %s", err, out)
+	}
+
+	n, _ := strconv.Atoi(m[1])
+	file := strings.TrimSuffix(m[2], ",")
+	return fmt.Errorf(
+		"dnsmasq configuration test failed at line %d of %s: %q: %s",
+		n, filepath.Join(c.liveDir(), filepath.Base(file)), lineOf(file, n), out,
+	)
+}
+
+// lineOf returns line n of a file, or "" if it can't be read
+func lineOf(file string, n int) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	b := bufio.NewScanner(f)
+	for i := 1; b.Scan(); i++ {
+		if i == n {
+			return b.Text()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeDNStest rejects any included file containing "bogus", reporting it the way dnsmasq --test does
+const fakeDNStest = `#!/bin/sh
+for a in "$@"; do
+	case "$a" in
+	--conf-file=*) conf="${a#--conf-file=}" ;;
+	esac
+done
+for f in $(sed -n 's/^conf-file=//p' "$conf"); do
+	n=$(grep -n bogus "$f" | head -1 | cut -d: -f1)
+	if [ -n "$n" ]; then
+		echo "dnsmasq: bad option at line $n of $f"
+		exit 1
+	fi
+done
+echo "dnsmasq: syntax check OK."
+`
+
+func TestDNStest(t *testing.T) {
+	Convey("Testing dnsmasq configuration validation", t, func() {
+		dir, err := ioutil.TempDir("/tmp", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			dns  = filepath.Join(dir, "dnsmasq.d")
+			test = filepath.Join(dir, "dnsmasq-test")
+			src  = filepath.Join(dir, "ads.txt")
+		)
+		So(os.MkdirAll(dns, 0o755), ShouldBeNil)
+		So(ioutil.WriteFile(test, []byte(fakeDNStest), 0o755), ShouldBeNil)
+		So(ioutil.WriteFile(src, []byte("ads.example.com\n"), 0o644), ShouldBeNil)
+
+		c := NewConfig(
+			Dir(dns),
+			DNStest(test+" --test"),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			Logger(newLog()),
+			OutDir(filepath.Join(dir, "blacklist.out")),
+			Prefix("address=", "server="),
+			WCard(Wildcard{Node: "*s", Name: "*"}),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(`blacklist {
+    dns-redirect-ip 0.0.0.0
+    domains {
+        source ads {
+            file %s
+        }
+    }
+}`, src)}), ShouldBeNil)
+
+		So(c.Begin(), ShouldBeNil)
+		defer c.Rollback()
+
+		ct, err := c.NewContent(FileObj)
+		So(err, ShouldBeNil)
+		So(c.ProcessContent(ct), ShouldBeNil)
+
+		Convey("with valid files", func() {
+			So(c.Validate(), ShouldBeNil)
+		})
+
+		Convey("with a malformed file", func() {
+			f := filepath.Join(c.Dir, "domains.ads.blacklist.conf")
+			So(ioutil.WriteFile(f, []byte("address=/ads.example.com/0.0.0.0\nbogus=/x/\n"), 0o644), ShouldBeNil)
+
+			err := c.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, fmt.Sprintf(
+				"dnsmasq configuration test failed at line 2 of %s: %q:",
+				filepath.Join(dns, "domains.ads.blacklist.conf"), "bogus=/x/",
+			))
+		})
+
+		Convey("with RPZ output", func() {
+			c.SetOpt(DNStest(test))
+			c.tree[domains].output = rpzOut
+			c.tree.validate(domains)
+			So(os.MkdirAll(c.OutDir, 0o755), ShouldBeNil)
+			f := filepath.Join(c.OutDir, "domains.ads.blacklist.conf")
+			So(ioutil.WriteFile(f, []byte("bogus CNAME .\n"), 0o644), ShouldBeNil)
+			So(c.Validate(), ShouldBeNil)
+		})
+
+		Convey("with the test command missing", func() {
+			c.SetOpt(DNStest(filepath.Join(dir, "missing") + " --test"))
+			So(c.Validate(), ShouldBeNil)
+		})
+
+		Convey("with the test disabled", func() {
+			c.SetOpt(DNStest(""))
+			So(c.Validate(), ShouldBeNil)
+		})
+	})
+}
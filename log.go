@@ -18,17 +18,18 @@ var (
 		logging.NOTICE:   logging.ColorSeqBold(logging.ColorCyan),
 		logging.DEBUG:    logging.ColorSeqBold(logging.ColorBlue),
 	}
-	fdFmttr    logging.Backend
-	haveTerm   = inTerminal
-	log        = newLog(prefix)
-	logCritf   = log.Criticalf
-	logErrorf  = func(f string, args ...interface{}) { log.Errorf(f, args...) }
-	logFatalf  = func(f string, args ...interface{}) { logCritf(f, args...); exitCmd(1) }
-	logFile    = setLogFile(runtime.GOOS)
-	logInfo    = log.Info
-	logInfof   = log.Infof
-	logNoticef = log.Noticef
-	logPrintf  = logInfof
+	fdFmttr     logging.Backend
+	haveTerm    = inTerminal
+	log         = newLog(prefix)
+	logCritf    = log.Criticalf
+	logErrorf   = func(f string, args ...interface{}) { log.Errorf(f, args...) }
+	logFatalf   = func(f string, args ...interface{}) { logCritf(f, args...); exitCmd(1) }
+	logFile     = setLogFile(runtime.GOOS)
+	logInfo     = log.Info
+	logInfof    = log.Infof
+	logNoticef  = log.Noticef
+	logPrintf   = logInfof
+	logWarningf = log.Warningf
 )
 
 // inTerminal returns true if the current terminal is interactive
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"time"
 
+	"github.com/britannic/blacklist/internal/dnsmasq"
 	e "github.com/britannic/blacklist/internal/edgeos"
 )
 
@@ -23,6 +29,7 @@ var (
 	prog         = basename(os.Args[0])
 	prefix       = fmt.Sprintf("%s: ", prog)
 	bkpCfgFile   = "/config/user-data/blacklist.failover.cfg"
+	cmdArgs      []string // command and arguments given after the flags
 	stdCfgFile   = "/config/config.boot"
 )
 
@@ -66,22 +73,65 @@ func main() {
 
 	c.Debug(fmt.Sprintf("Dumping commandline args: %v", os.Args[1:]))
 	c.Debug(fmt.Sprintf("Dumping env variables: %v", c))
-	logNoticef("%v", "Starting blacklist update...")
+	command(c, cmdArgs)
 
-	if !e.ChkWeb("www.google.com", 443) {
-		logFatalf("%s", "No internet access, aborting blacklist update!")
+	if !c.Disabled {
+		preflight(c)
 	}
 
-	logInfo("Checking for stale blacklists...")
-	if err = removeStaleFiles(c); err != nil {
-		logFatalf("%v", err.Error())
+	logNoticef("%v", "Starting blacklist update...")
+
+	if !c.Disabled && !c.Offline {
+		probe(c)
 	}
 
 	// _, _ = context.WithTimeout(context.Background(), c.Timeout)
 
+	for _, t := range c.Targets() {
+		updateTarget(t, objex)
+	}
+
+	purgeUntargeted(c)
+
+	logNoticef("%v", "Blacklist update completed......")
+}
+
+// purgeUntargeted removes the blacklist files left in the global directories from before targets were
+// configured and reloads the global dnsmasq so it drops them
+func purgeUntargeted(c *e.Config) {
+	stale, err := c.PurgeUntargeted()
+	if err != nil {
+		logErrorf("unable to remove untargeted blacklist files: %v", err.Error())
+	}
+
+	if len(stale) > 0 {
+		logNoticef("Removed %d blacklist files left in %s from before targets were configured", len(stale), c.Dir)
+		reloadDNS(c)
+	}
+}
+
+// updateTarget updates and reloads the blacklist files of one dnsmasq instance
+func updateTarget(c *e.Config, objex []e.IFace) {
+	if c.Target != "" {
+		logNoticef("Updating blacklist target %s in %s", c.Target, c.Dir)
+	}
+
+	snapshot(c)
+
+	if c.Disabled {
+		logInfo("Checking for stale blacklists...")
+		if err := removeStaleFiles(c); err != nil {
+			logFatalf("%v", err.Error())
+		}
+	}
+
 	if !c.Disabled {
-		if err := processObjects(c, objex); err != nil {
-			logErrorf("%v", err.Error())
+		if err := stageUpdate(c, objex); err != nil {
+			logFatalf("%v, previous blacklist left in place", err.Error())
+		}
+
+		if _, err := c.SaveGeneration(); err != nil {
+			logErrorf("unable to save blacklist generation: %v", err.Error())
 		}
 	}
 
@@ -92,9 +142,196 @@ func main() {
 		c.Log.Noticef("Total entries dropped %d", dropped)
 	}
 
+	mirrors := c.GetMirrorStats()
+	names := make([]string, 0, len(mirrors))
+	for name := range mirrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.Log.Noticef("Source %s served by %s", name, mirrors[name])
+	}
+
 	reloadDNS(c)
 
-	logNoticef("%v", "Blacklist update completed......")
+	if c.Verify > 0 {
+		verify(c)
+	}
+}
+
+// snapshot records the live blacklist files, so dnsmasq is only reloaded if they change
+func snapshot(c *e.Config) {
+	if err := c.Snapshot(); err != nil {
+		logWarningf("unable to snapshot blacklist files, dnsmasq will be reloaded: %v", err)
+	}
+}
+
+// stageUpdate writes every blacklist file to a stage and commits it only if dnsmasq accepts it
+func stageUpdate(c *e.Config, objects []e.IFace) error {
+	if err := c.Begin(); err != nil {
+		return err
+	}
+
+	err := processObjects(c, objects)
+	if err == nil {
+		if n := c.Prune(); n > 0 {
+			logNoticef("Pruned %d entries already blocked by a parent domain", n)
+		}
+		err = c.WriteLayout()
+	}
+
+	if err == nil {
+		err = c.WriteRPZ()
+	}
+
+	if err == nil {
+		err = c.WriteSets()
+	}
+
+	if err == nil {
+		err = c.Validate()
+	}
+
+	if err != nil {
+		if rerr := c.Rollback(); rerr != nil {
+			logErrorf("%v", rerr.Error())
+		}
+		return err
+	}
+	return c.Commit()
+}
+
+// command runs the command given after the flags and exits, or returns if there isn't one
+func command(c *e.Config, args []string) {
+	if len(args) < 1 {
+		return
+	}
+
+	switch args[0] {
+	case "generations":
+		for _, t := range c.Targets() {
+			if t.Target != "" {
+				fmt.Printf("Target %s:\n", t.Target)
+			}
+
+			gens, err := t.Generations()
+			if err != nil {
+				logFatalf("%v", err.Error())
+			}
+			if len(gens) < 1 {
+				fmt.Printf("No blacklist generations saved in %s\n", t.GenDir)
+			}
+			for _, g := range gens {
+				fmt.Println(g)
+			}
+		}
+	case "lint":
+		for _, t := range c.Targets() {
+			findings, err := dnsmasq.Lint(t.Dir, "."+t.Ext)
+			if err != nil {
+				logFatalf("%v", err.Error())
+			}
+			if len(findings) < 1 {
+				fmt.Printf("No shadowed, duplicated or conflicting entries in %s\n", t.Dir)
+			}
+			for _, f := range findings {
+				fmt.Println(f)
+			}
+		}
+	case "querylog":
+		queryLog(c, args[1:])
+	case "rollback":
+		var id int
+		if len(args) > 1 {
+			var err error
+			if id, err = strconv.Atoi(args[1]); err != nil || id < 1 {
+				logFatalf("invalid generation %q", args[1])
+			}
+		}
+
+		for _, t := range c.Targets() {
+			snapshot(t)
+			g, err := t.Restore(id)
+			if err != nil {
+				logFatalf("rollback failed: %v", err.Error())
+			}
+			logNoticef("Restored blacklist generation %d from %s to %s", g.ID, g.Time.Local().Format(time.RFC3339), t.Dir)
+			reloadDNS(t)
+		}
+	default:
+		logFatalf("unknown command %q, use generations, lint, querylog [table|json] [file] or rollback [generation]", args[0])
+	}
+	exitCmd(0)
+}
+
+// queryLog reports the blacklist's hits in a dnsmasq query log read from a file or stdin, as a table or JSON
+func queryLog(c *e.Config, args []string) {
+	format := "table"
+	if len(args) > 0 && (args[0] == "table" || args[0] == "json") {
+		format, args = args[0], args[1:]
+	}
+
+	var r io.Reader = os.Stdin
+	if len(args) > 0 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			logFatalf("%v", err.Error())
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var files []string
+	for _, t := range c.Targets() {
+		files = append(files, t.GetAll().Files().Strings()...)
+	}
+
+	rpt, err := dnsmasq.QueryLog(r, files, "."+c.Ext, 10)
+	if err != nil {
+		logFatalf("unable to read query log: %v", err.Error())
+	}
+
+	if c.Merging() {
+		rpt.Note = fmt.Sprintf("Sources are the merged files of the %s output layout, which don't record the blacklist source of each entry", c.Layout)
+	}
+
+	if format == "json" {
+		b, err := json.MarshalIndent(rpt, "", "  ")
+		if err != nil {
+			logFatalf("%v", err.Error())
+		}
+		fmt.Println(string(b))
+		return
+	}
+	fmt.Print(rpt)
+}
+
+// preflight checks the installed dnsmasq can handle the configuration before any blacklist file is touched
+func preflight(c *e.Config) {
+	if err := c.CheckCaps(); err != nil {
+		logFatalf("%v, previous blacklist left in place", err.Error())
+	}
+}
+
+// probe checks connectivity for URL sources and applies the probe-failure policy
+func probe(c *e.Config) {
+	err := c.Probe()
+	if err == nil {
+		return
+	}
+
+	switch c.ProbeFailure() {
+	case e.ProbeCache:
+		if c.CacheDir != "" {
+			logWarningf("%v, rebuilding blacklists from last-known-good cached sources", err)
+			c.SetOpt(e.Offline(true))
+			return
+		}
+	case e.ProbeContinue:
+		logWarningf("%v, continuing blacklist update", err)
+		return
+	}
+	logFatalf("%v, aborting blacklist update!", err)
 }
 
 // basename removes directory components and file extensions.
@@ -155,15 +392,19 @@ func loadConfig(c *e.Config, o *opts) (*e.Config, error) {
 	return c, err
 }
 
-// processObjects processes local sources, downloads Internet sources and creates
-// dnsmasq configuration files
+// processObjects processes local sources and downloads Internet sources, leaving the
+// dnsmasq configuration files to WriteLayout
 func processObjects(c *e.Config, objects []e.IFace) error {
 	for _, o := range objects {
 		ct, err := c.NewContent(o)
 		if err != nil {
 			return err
 		}
-		if err = c.ProcessContent(ct); err != nil {
+		var serr *e.SourceError
+		switch err = c.Process(ct); {
+		case errors.As(err, &serr):
+			logWarningf("%v, keeping the previous blacklist entries", serr.Error())
+		case err != nil:
 			return err
 		}
 	}
@@ -172,11 +413,26 @@ func processObjects(c *e.Config, objects []e.IFace) error {
 
 // reloadDNS reloads the latest processed dnsmasq configuration files
 func reloadDNS(c *e.Config) {
-	if b, err := c.ReloadDNS(); err != nil {
-		logErrorf("ReloadDNS(): %v\n error: %v\n", string(b), err.Error())
+	r, err := c.ReloadDNS()
+	if err != nil {
+		logErrorf("ReloadDNS(): %v\n error: %v\n", string(r.Out), err.Error())
 		exitCmd(1)
 	}
-	logPrintf("%s", "Successfully restarted dnsmasq")
+	logPrintf("%s", r)
+}
+
+// verify checks the running resolver's answers for a sample of blocked and excluded entries
+func verify(c *e.Config) {
+	r, err := dnsmasq.Verify(c.VerifySvr, c.GetAll().Files().Strings(), c.Verify)
+	if err != nil {
+		logErrorf("unable to verify blacklist: %v", err.Error())
+		return
+	}
+
+	for _, m := range r.Mismatches() {
+		logWarningf("Verify mismatch: %v", m)
+	}
+	logNoticef("%v", r)
 }
 
 // removeStaleFiles deletes redundant files
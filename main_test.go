@@ -249,11 +249,8 @@ func TestProcessObjects(t *testing.T) {
 
 		Convey("Testing processObjects() with a non-existent directory ", func() {
 			c.Dir = "EinenSieAugenBlick"
-			So(
-				processObjects(c, []e.IFace{e.FileObj}),
-				ShouldResemble,
-				errors.New(badFileError),
-			)
+			So(processObjects(c, []e.IFace{e.FileObj}), ShouldBeNil)
+			So(c.WriteLayout(), ShouldResemble, errors.New(badFileError))
 		})
 	})
 }
@@ -292,6 +289,11 @@ func TestSetArgs(t *testing.T) {
 			args: []string{prog, "-version"},
 			exp:  true,
 		},
+		{
+			name: "offline",
+			args: []string{prog, "-offline"},
+			exp:  true,
+		},
 		{
 			name: "v",
 			args: []string{prog, "-v"},
@@ -408,7 +410,7 @@ func TestReloadDNS(t *testing.T) {
 	Convey("Testing ReloadDNS()", t, func() {
 		var (
 			act string
-			exp = "[Successfully restarted dnsmasq]"
+			exp = "[dnsmasq not reloaded, no blacklist files changed]"
 		)
 
 		// if IsDrone() {
@@ -421,6 +423,7 @@ func TestReloadDNS(t *testing.T) {
 			act = fmt.Sprintf(s, v)
 		}
 
+		So(c.Snapshot(), ShouldBeNil)
 		reloadDNS(c)
 		So(act, ShouldEqual, exp)
 	})
@@ -470,6 +473,15 @@ func TestSetArch(t *testing.T) {
 		for _, test := range tests {
 			So(o.setDir(test.arch), ShouldEqual, test.exp)
 		}
+
+		So(o.setCacheDir("mips64"), ShouldEqual, "/config/user-data/blacklist.cache")
+		So(o.setCacheDir("linux"), ShouldEqual, "/tmp/blacklist.cache")
+		So(o.setDataDir("mipsle"), ShouldEqual, "/config/user-data/blacklist.hosts")
+		So(o.setDataDir("darwin"), ShouldEqual, "/tmp/blacklist.hosts")
+		So(o.setGenDir("mips64"), ShouldEqual, "/config/user-data/blacklist.generations")
+		So(o.setGenDir("linux"), ShouldEqual, "/tmp/blacklist.generations")
+		So(o.setOutDir("mipsle"), ShouldEqual, "/config/user-data/blacklist.out")
+		So(o.setOutDir("linux"), ShouldEqual, "/tmp/blacklist.out")
 	})
 }
 
@@ -505,19 +517,31 @@ func TestInitEdgeOS(t *testing.T) {
 		"ExtraCalldepth": 0
 	},
 	"API": "/bin/cli-shell-api",
+	"User agent": "edgeos-dnsmasq-blacklist/UNKNOWN",
 	"Arch": "arm64",
 	"Bash": "/bin/bash",
+	"Cache max age": 604800000000000,
+	"Cache dir": "/tmp/blacklist.cache",
 	"Cores": 2,
+	"Data dir": "/tmp/blacklist.hosts",
 	"Disabled": false,
 	"Dex": {},
 	"Dir": "/tmp",
 	"dnsmasq service": "/etc/init.d/dnsmasq restart",
+	"dnsmasq test": "/usr/sbin/dnsmasq --test",
+	"dnsmasq version": "/usr/sbin/dnsmasq --version",
 	"Exc": {},
 	"dnsmasq fileExt.": "blacklist.conf",
 	"File name fmt": "%v/%v.%v.%v",
+	"Generations dir": "/tmp/blacklist.generations",
+	"Generations kept": 3,
 	"HTTP method": "GET",
+	"Output dir": "/tmp/blacklist.out",
 	"Prefix": {},
+	"dnsmasq pid file": "/var/run/dnsmasq/dnsmasq.pid",
+	"Reload strategy": "restart",
 	"Timeout": 30000000000,
+	"Verify server": "127.0.0.1:53",
 	"Wildcard": {
 		"Node": "*s",
 		"Name": "*"
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -17,19 +18,34 @@ import (
 // opts struct for command line options and setting initial variables
 type opts struct {
 	*mflag.FlagSet
-	ARCH    *string
-	Dbug    *bool
-	DNSdir  *string
-	DNStmp  *string
-	File    *string
-	Help    *bool
-	MIPSLE  *string
-	MIPS64  *string
-	OS      *string
-	Safe    *bool
-	Test    *bool
-	Verb    *bool
-	Version *bool
+	ARCH      *string
+	Cache     *string
+	CacheAge  *time.Duration
+	DataDir   *string
+	Dbug      *bool
+	DNSdir    *string
+	DNStest   *string
+	DNStmp    *string
+	DNSver    *string
+	File      *string
+	Force     *bool
+	GenDir    *string
+	GenKeep   *int
+	Help      *bool
+	MIPSLE    *string
+	MIPS64    *string
+	Offline   *bool
+	OS        *string
+	OutDir    *string
+	PidFile   *string
+	Reload    *string
+	ReloadCmd *string
+	Safe      *bool
+	Test      *bool
+	Verb      *bool
+	Verify    *int
+	VerifySvr *string
+	Version   *bool
 }
 
 // cleanArgs removes flags when code is being tested
@@ -75,20 +91,35 @@ func getOpts() *opts {
 	var (
 		flags mflag.FlagSet
 		o     = &opts{
-			FlagSet: &flags,
-			ARCH:    flags.String("arch", runtime.GOARCH, "Set EdgeOS CPU architecture", false),
-			DNSdir:  flags.String("dir", "/etc/dnsmasq.d", "Override dnsmasq directory", true),
-			DNStmp:  flags.String("tmp", "/tmp", "Override dnsmasq temporary directory", false),
-			Dbug:    flags.Bool("debug", false, "Enable Debug mode", false),
-			File:    flags.String("f", "", "`<file>` # Load a config.boot file", true),
-			Help:    flags.Bool("h", false, "Display help", true),
-			MIPS64:  flags.String("mips64", "mips64", "Override target EdgeOS CPU architecture", false),
-			MIPSLE:  flags.String("mipsle", "mipsle", "Override target EdgeOS CPU architecture", false),
-			OS:      flags.String("os", runtime.GOOS, "Override native EdgeOS OS", false),
-			Safe:    flags.Bool("safe", false, fmt.Sprintf("Fail over to %s", bkpCfgFile), true),
-			Test:    flags.Bool("dryrun", false, "Run config and data validation tests", false),
-			Verb:    flags.Bool("v", false, "Verbose display", true),
-			Version: flags.Bool("version", false, "Show version", true),
+			FlagSet:   &flags,
+			ARCH:      flags.String("arch", runtime.GOARCH, "Set EdgeOS CPU architecture", false),
+			Cache:     flags.String("cache", "/config/user-data/blacklist.cache", "Override last-known-good source cache directory", false),
+			CacheAge:  flags.Duration("cache-age", 7*24*time.Hour, "Maximum age of a last-known-good source copy", false),
+			DataDir:   flags.String("datadir", "/config/user-data/blacklist.hosts", "Override addn-hosts file directory", false),
+			DNSdir:    flags.String("dir", "/etc/dnsmasq.d", "Override dnsmasq directory", true),
+			DNStest:   flags.String("dnstest", "/usr/sbin/dnsmasq --test", "Override dnsmasq configuration test command", false),
+			DNStmp:    flags.String("tmp", "/tmp", "Override dnsmasq temporary directory", false),
+			DNSver:    flags.String("dnsver", "/usr/sbin/dnsmasq --version", "Override dnsmasq version command", false),
+			Dbug:      flags.Bool("debug", false, "Enable Debug mode", false),
+			File:      flags.String("f", "", "`<file>` # Load a config.boot file", true),
+			Force:     flags.Bool("force", false, "Reload dnsmasq even if no blacklist file changed", true),
+			GenDir:    flags.String("gendir", "/config/user-data/blacklist.generations", "Override blacklist generations directory", false),
+			GenKeep:   flags.Int("generations", 3, "Number of blacklist generations to keep", false),
+			Help:      flags.Bool("h", false, "Display help", true),
+			MIPS64:    flags.String("mips64", "mips64", "Override target EdgeOS CPU architecture", false),
+			MIPSLE:    flags.String("mipsle", "mipsle", "Override target EdgeOS CPU architecture", false),
+			Offline:   flags.Bool("offline", false, "Rebuild blacklists from cached sources without downloading", true),
+			OS:        flags.String("os", runtime.GOOS, "Override native EdgeOS OS", false),
+			OutDir:    flags.String("outdir", "/config/user-data/blacklist.out", "Override Unbound and RPZ output directory", false),
+			PidFile:   flags.String("pidfile", "/var/run/dnsmasq/dnsmasq.pid", "Override dnsmasq PID file", false),
+			Reload:    flags.String("reload", e.ReloadRestart, "Reload dnsmasq using restart, signal or custom", true),
+			ReloadCmd: flags.String("reloadcmd", "", "`<command>` # Command run by the custom reload strategy", false),
+			Safe:      flags.Bool("safe", false, fmt.Sprintf("Fail over to %s", bkpCfgFile), true),
+			Test:      flags.Bool("dryrun", false, "Run config and data validation tests", false),
+			Verb:      flags.Bool("v", false, "Verbose display", true),
+			Verify:    flags.Int("verify", 0, "`<n>` # Check the resolver's answers for n blocked and n excluded entries after updating", true),
+			VerifySvr: flags.String("verify-server", "127.0.0.1:53", "Override DNS server queried by -verify", false),
+			Version:   flags.Bool("version", false, "Show version", true),
 		}
 	)
 	flags.Init(prog, mflag.ExitOnError)
@@ -106,20 +137,36 @@ func (o *opts) initEdgeOS() *e.Config {
 		e.API("/bin/cli-shell-api"),
 		e.Arch(runtime.GOARCH),
 		e.Bash("/bin/bash"),
+		e.CacheAge(*o.CacheAge),
+		e.CacheDir(o.setCacheDir(*o.ARCH)),
 		e.Cores(2),
+		e.DataDir(o.setDataDir(*o.ARCH)),
 		e.Disabled(false),
 		e.Dbug(*o.Dbug),
 		e.Dir(o.setDir(*o.ARCH)),
 		e.DNSsvc(dnsmasq),
+		e.DNStest(*o.DNStest),
+		e.DNSver(*o.DNSver),
 		e.Ext("blacklist.conf"),
 		e.File(*o.File),
 		e.FileNameFmt("%v/%v.%v.%v"),
+		e.Force(*o.Force),
+		e.GenDir(o.setGenDir(*o.ARCH)),
+		e.GenKeep(*o.GenKeep),
 		e.InCLI("inSession"),
 		e.Method("GET"),
+		e.Offline(*o.Offline),
+		e.OutDir(o.setOutDir(*o.ARCH)),
+		e.PidFile(*o.PidFile),
 		e.Prefix("address=", "server="),
+		e.Reload(*o.Reload),
+		e.ReloadCmd(*o.ReloadCmd),
 		e.Logger(log),
 		e.Timeout(30*time.Second),
+		e.UserAgent(fmt.Sprintf("edgeos-dnsmasq-blacklist/%s", version)),
 		e.Verb(*o.Verb),
+		e.Verify(*o.Verify),
+		e.VerifyServer(*o.VerifySvr),
 		e.WCard(e.Wildcard{Node: "*s", Name: "*"}),
 	)
 }
@@ -129,6 +176,7 @@ func (o *opts) setArgs() {
 	if o.Parse(cleanArgs((os.Args[1:]))) != nil {
 		exitCmd(0)
 	}
+	cmdArgs = o.Args()
 
 	if *o.Dbug {
 		screenLog("")
@@ -172,6 +220,42 @@ func (o *opts) setArgs() {
 	}
 }
 
+// setCacheDir sets the last-known-good source cache directory according to the host CPU arch
+func (o *opts) setCacheDir(arch string) string {
+	switch arch {
+	case *o.MIPSLE, *o.MIPS64:
+		return *o.Cache
+	}
+	return filepath.Join(*o.DNStmp, "blacklist.cache")
+}
+
+// setDataDir sets the addn-hosts file directory according to the host CPU arch
+func (o *opts) setDataDir(arch string) string {
+	switch arch {
+	case *o.MIPSLE, *o.MIPS64:
+		return *o.DataDir
+	}
+	return filepath.Join(*o.DNStmp, "blacklist.hosts")
+}
+
+// setGenDir sets the blacklist generations directory according to the host CPU arch
+func (o *opts) setGenDir(arch string) string {
+	switch arch {
+	case *o.MIPSLE, *o.MIPS64:
+		return *o.GenDir
+	}
+	return filepath.Join(*o.DNStmp, "blacklist.generations")
+}
+
+// setOutDir sets the Unbound and RPZ output directory according to the host CPU arch
+func (o *opts) setOutDir(arch string) string {
+	switch arch {
+	case *o.MIPSLE, *o.MIPS64:
+		return *o.OutDir
+	}
+	return filepath.Join(*o.DNStmp, "blacklist.out")
+}
+
 // setDir sets the directory according to the host CPU arch
 func (o *opts) setDir(arch string) string {
 	switch arch {